@@ -0,0 +1,151 @@
+package main
+
+import (
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goerzh/drone-kube/util"
+	"github.com/pkg/errors"
+)
+
+type clusterResult struct {
+	name     string
+	err      error
+	skipped  bool
+	duration time.Duration
+}
+
+// fanOut runs the action against every configured cluster, one after the
+// other or Config.Parallelism at a time. Unless Config.OnFailure is
+// "continue", no further cluster is started after the first failure.
+func (p *Plugin) fanOut() error {
+	clusters := p.Config.Clusters
+	results := make([]clusterResult, len(clusters))
+
+	parallelism := p.Config.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	sem := make(chan struct{}, parallelism)
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed bool
+	)
+	for i, target := range clusters {
+		name := target.Name
+		if name == "" {
+			name = target.Server
+		}
+		results[i].name = name
+
+		sem <- struct{}{}
+		mu.Lock()
+		stop := failed && p.Config.OnFailure != "continue"
+		mu.Unlock()
+		if stop {
+			<-sem
+			results[i].skipped = true
+			continue
+		}
+
+		cp := p.forCluster(target)
+
+		wg.Add(1)
+		go func(i int, cp *Plugin) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			log.Printf("deploy to cluster %s", cp.Cluster.Name)
+			start := time.Now()
+			err := cp.runCluster()
+			results[i].duration = time.Since(start)
+			results[i].err = err
+			if err != nil {
+				log.Printf("cluster %s failed: %s", cp.Cluster.Name, err)
+				mu.Lock()
+				failed = true
+				mu.Unlock()
+			}
+		}(i, cp)
+	}
+	wg.Wait()
+
+	failures := 0
+	log.Println("cluster summary:")
+	for _, res := range results {
+		switch {
+		case res.skipped:
+			log.Printf("  %s: skipped", res.name)
+		case res.err != nil:
+			failures++
+			log.Printf("  %s: failed after %s: %s", res.name, res.duration.Round(time.Second), res.err)
+		default:
+			log.Printf("  %s: ok in %s", res.name, res.duration.Round(time.Second))
+		}
+	}
+
+	if failures > 0 {
+		return errors.Errorf("%d of %d clusters failed", failures, len(clusters))
+	}
+	return nil
+}
+
+// forCluster returns a copy of the plugin set up for one fan-out target.
+func (p *Plugin) forCluster(target util.Cluster) *Plugin {
+	cp := *p
+	cp.Cluster = Cluster{Name: target.Name, Values: target.Values}
+	if cp.Cluster.Name == "" {
+		cp.Cluster.Name = target.Server
+	}
+	cp.Config.Clusters = nil
+	if target.Server != "" {
+		cp.Config.Server = expandRef(target.Server)
+	}
+	if target.Token != "" {
+		cp.Config.Token = expandRef(target.Token)
+		util.Sensitive(cp.Config.Token)
+	}
+	if target.Ca != "" {
+		cp.Config.Ca = expandRef(target.Ca)
+	}
+	if target.Namespace != "" {
+		cp.Config.Namespace = target.Namespace
+	}
+	return &cp
+}
+
+// a setting that is only a reference to an environment variable
+var envRef = regexp.MustCompile(`^\$(?:\{([A-Za-z_][A-Za-z0-9_]*)\}|([A-Za-z_][A-Za-z0-9_]*))$`)
+
+// expandRef returns the value of the environment variable when s is exactly
+// a ${VAR} or $VAR reference, and s as is otherwise, so a literal token or
+// certificate holding a $ is left alone.
+func expandRef(s string) string {
+	m := envRef.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return s
+	}
+	return os.Getenv(m[1] + m[2])
+}
+
+// runCluster checks the credentials of a fan-out target before running it.
+func (p *Plugin) runCluster() error {
+	if p.Config.Server == "" {
+		return errors.New("server is not defined")
+	}
+	if p.Config.Token == "" {
+		return errors.New("token is not defined")
+	}
+	if p.Config.Ca == "" {
+		return errors.New("ca is not defined")
+	}
+	return p.run()
+}
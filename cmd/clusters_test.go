@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/goerzh/drone-kube/util"
+)
+
+func TestForClusterExpandsReferencesOnly(t *testing.T) {
+	t.Setenv("KUBE_TOKEN_EU", "eu-token")
+	t.Setenv("KUBE_SERVER_EU", "https://eu.example.com")
+	t.Setenv("ab", "expanded")
+
+	p := &Plugin{Config: util.Config{Server: "https://default", Token: "default", Ca: "ca"}}
+	tests := []struct {
+		target util.Cluster
+		want   util.Config
+	}{
+		{
+			util.Cluster{Server: "$KUBE_SERVER_EU", Token: "${KUBE_TOKEN_EU}"},
+			util.Config{Server: "https://eu.example.com", Token: "eu-token", Ca: "ca"},
+		},
+		{
+			// literals holding a $ are kept as they are
+			util.Cluster{Token: "p4$$w0rd$ab", Ca: "LS0t$ab/${ab}x"},
+			util.Config{Server: "https://default", Token: "p4$$w0rd$ab", Ca: "LS0t$ab/${ab}x"},
+		},
+		{
+			util.Cluster{Token: "${UNSET_TOKEN_REF}"},
+			util.Config{Server: "https://default", Token: "", Ca: "ca"},
+		},
+	}
+	for _, tt := range tests {
+		cfg := p.forCluster(tt.target).Config
+		if cfg.Server != tt.want.Server || cfg.Token != tt.want.Token || cfg.Ca != tt.want.Ca {
+			t.Errorf("%+v: got server %q token %q ca %q, want %q %q %q", tt.target,
+				cfg.Server, cfg.Token, cfg.Ca, tt.want.Server, tt.want.Token, tt.want.Ca)
+		}
+	}
+}
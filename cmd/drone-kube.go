@@ -1,23 +1,48 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/goerzh/drone-kube/util"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/pkg/errors"
 	"github.com/urfave/cli"
 )
 
 var build = "0" // build number set at compile time
 
 func main() {
+	// nothing sensitive reaches the build logs
+	log.SetOutput(util.DefaultRedactor.Writer(os.Stderr))
+
 	app := cli.NewApp()
 	app.Name = "drone-kube"
 	app.Action = run
 	app.Version = fmt.Sprintf("1.0.%s", build)
+	app.Commands = []cli.Command{
+		{
+			Name:   "render",
+			Usage:  "print the rendered manifests without talking to a cluster",
+			Action: render,
+		},
+	}
 	app.Flags = []cli.Flag{
+		cli.BoolFlag{
+			Name:   "render-only",
+			Usage:  "print the rendered manifests instead of applying them",
+			EnvVar: "PLUGIN_RENDER_ONLY",
+		},
+		cli.StringFlag{
+			Name:   "action",
+			Value:  "apply",
+			Usage:  "what to do: apply, scale, pause, resume, restart, delete or status",
+			EnvVar: "PLUGIN_ACTION",
+		},
 		cli.StringFlag{
 			Name:   "token",
 			Usage:  "Kubernetes token used by user to talk to app",
@@ -38,9 +63,39 @@ func main() {
 			Usage:  "namespace to use: 'default' is the default :-)",
 			EnvVar: "KUBE_NAMESPACE,PLUGIN_NAMESPACE",
 		},
-		cli.StringFlag{
+		cli.BoolFlag{
+			Name:   "create-namespace",
+			Usage:  "create the namespace if it does not exist",
+			EnvVar: "PLUGIN_CREATE_NAMESPACE",
+		},
+		cli.StringSliceFlag{
+			Name:   "namespace.labels",
+			Usage:  "labels of a created namespace: team=web",
+			EnvVar: "PLUGIN_NAMESPACE_LABELS",
+		},
+		cli.StringSliceFlag{
+			Name:   "namespace.annotations",
+			Usage:  "annotations of a created namespace: owner=web",
+			EnvVar: "PLUGIN_NAMESPACE_ANNOTATIONS",
+		},
+		cli.StringSliceFlag{
+			Name:   "namespace.quota",
+			Usage:  "hard limits of the quota of a created namespace: requests.cpu=4",
+			EnvVar: "PLUGIN_NAMESPACE_QUOTA",
+		},
+		cli.StringSliceFlag{
+			Name:   "namespace.limits",
+			Usage:  "default container limits of a created namespace: memory=512Mi",
+			EnvVar: "PLUGIN_NAMESPACE_LIMITS",
+		},
+		cli.StringSliceFlag{
+			Name:   "namespace.requests",
+			Usage:  "default container requests of a created namespace: cpu=100m",
+			EnvVar: "PLUGIN_NAMESPACE_REQUESTS",
+		},
+		cli.StringSliceFlag{
 			Name:   "template",
-			Usage:  "template file to use for deployment: mydeployment.yaml :-)",
+			Usage:  "template files, directories or globs to deploy: k8s/*.yaml :-)",
 			EnvVar: "KUBE_TEMPLATE,PLUGIN_TEMPLATE,PLUGIN_DEPLOY,PLUGIN_DEPLOY_TEMPLATE",
 		},
 		cli.StringFlag{
@@ -53,6 +108,303 @@ func main() {
 			Usage:  "template file to use for ingress: ingress.yaml :-)",
 			EnvVar: "KUBE_INGRESS_TEMPLATE,PLUGIN_INGRESS,PLUGIN_INGRESS_TEMPLATE",
 		},
+		cli.BoolFlag{
+			Name:   "pin-digests",
+			Usage:  "resolve image tags to their sha256 digest before applying",
+			EnvVar: "PLUGIN_PIN_DIGESTS",
+		},
+		cli.StringFlag{
+			Name:   "registry",
+			Usage:  "registry the supplied credentials belong to, all registries if empty",
+			EnvVar: "PLUGIN_REGISTRY",
+		},
+		cli.StringFlag{
+			Name:   "registry.username",
+			Usage:  "registry username used to resolve image digests",
+			EnvVar: "REGISTRY_USERNAME,PLUGIN_REGISTRY_USERNAME",
+		},
+		cli.StringFlag{
+			Name:   "registry.password",
+			Usage:  "registry password used to resolve image digests",
+			EnvVar: "REGISTRY_PASSWORD,PLUGIN_REGISTRY_PASSWORD",
+		},
+		cli.BoolFlag{
+			Name:   "registry.insecure",
+			Usage:  "talk to the registry over plain http",
+			EnvVar: "PLUGIN_REGISTRY_INSECURE",
+		},
+		cli.StringSliceFlag{
+			Name:   "policy",
+			Usage:  "built-in policy rules the objects have to satisfy",
+			EnvVar: "PLUGIN_POLICY",
+		},
+		cli.StringSliceFlag{
+			Name:   "policy.registries",
+			Usage:  "image prefixes allowed by the allowed-registries rule",
+			EnvVar: "PLUGIN_POLICY_REGISTRIES",
+		},
+		cli.StringSliceFlag{
+			Name:   "policy.rules",
+			Usage:  "rego policy rule files, globs or urls",
+			EnvVar: "PLUGIN_POLICY_RULES",
+		},
+		cli.BoolFlag{
+			Name:   "policy.warn",
+			Usage:  "only report policy violations instead of failing",
+			EnvVar: "PLUGIN_POLICY_WARN",
+		},
+		cli.StringSliceFlag{
+			Name:   "restart",
+			Usage:  "deployments to restart even if their manifests did not change",
+			EnvVar: "PLUGIN_RESTART",
+		},
+		cli.BoolFlag{
+			Name:   "config-hash",
+			Usage:  "add a hash of the referenced configmaps and secrets to the pod template",
+			EnvVar: "PLUGIN_CONFIG_HASH",
+		},
+		cli.BoolFlag{
+			Name:   "provenance",
+			Usage:  "annotate every object and pod template with the build that deployed it",
+			EnvVar: "PLUGIN_PROVENANCE",
+		},
+		cli.BoolFlag{
+			Name:   "events",
+			Usage:  "record a kubernetes event on every applied object",
+			EnvVar: "PLUGIN_EVENTS",
+		},
+		cli.BoolFlag{
+			Name:   "wait",
+			Usage:  "wait for the rollout of restarted, scaled, resumed and rolled back deployments, and for deleted objects to disappear",
+			EnvVar: "PLUGIN_WAIT",
+		},
+		cli.IntFlag{
+			Name:   "retry.attempts",
+			Value:  5,
+			Usage:  "how many times to try api calls that fail on conflicts, throttling or connection errors",
+			EnvVar: "PLUGIN_RETRY_ATTEMPTS",
+		},
+		cli.DurationFlag{
+			Name:   "retry.deadline",
+			Value:  2 * time.Minute,
+			Usage:  "how long to keep retrying an api call, counted from its first attempt",
+			EnvVar: "PLUGIN_RETRY_DEADLINE",
+		},
+		cli.StringSliceFlag{
+			Name:   "wait-for",
+			Usage:  "kinds of the applied objects to wait for until they are ready, or all",
+			EnvVar: "PLUGIN_WAIT_FOR",
+		},
+		cli.DurationFlag{
+			Name:   "timeout",
+			Value:  5 * time.Minute,
+			Usage:  "how long to wait for a rollout or for objects to be ready",
+			EnvVar: "PLUGIN_TIMEOUT",
+		},
+		cli.StringSliceFlag{
+			Name:   "deployments",
+			Usage:  "deployments the scale, pause, resume, restart, delete and status actions work on",
+			EnvVar: "PLUGIN_DEPLOYMENTS",
+		},
+		cli.IntFlag{
+			Name:   "replicas",
+			Usage:  "number of replicas for the scale action",
+			EnvVar: "PLUGIN_REPLICAS",
+		},
+		cli.StringFlag{
+			Name:   "propagation",
+			Value:  "background",
+			Usage:  "how the delete action removes dependents: background, foreground or orphan",
+			EnvVar: "PLUGIN_PROPAGATION",
+		},
+		cli.StringSliceFlag{
+			Name:   "notify-webhook",
+			Usage:  "urls to post notifications of the start and outcome of the run to",
+			EnvVar: "PLUGIN_NOTIFY_WEBHOOK",
+		},
+		cli.StringFlag{
+			Name:   "notify-template",
+			Usage:  "handlebars template or url of the notification payload",
+			EnvVar: "PLUGIN_NOTIFY_TEMPLATE",
+		},
+		cli.StringSliceFlag{
+			Name:   "notify-on",
+			Usage:  "outcomes to notify of: started, success, failure",
+			EnvVar: "PLUGIN_NOTIFY_ON",
+		},
+		cli.StringSliceFlag{
+			Name:   "notify-headers",
+			Usage:  "key=value http headers of the notifications",
+			EnvVar: "PLUGIN_NOTIFY_HEADERS",
+		},
+		cli.IntFlag{
+			Name:   "notify-retries",
+			Usage:  "times to retry a notification",
+			Value:  2,
+			EnvVar: "PLUGIN_NOTIFY_RETRIES",
+		},
+		cli.StringFlag{
+			Name:   "report-file",
+			Usage:  "write a json report of the run to this file",
+			EnvVar: "PLUGIN_REPORT_FILE",
+		},
+		cli.StringFlag{
+			Name:   "smoke-test",
+			Usage:  "url to check after the deploy, service://name[.namespace][:port]/path goes through the api server",
+			EnvVar: "PLUGIN_SMOKE_TEST",
+		},
+		cli.IntFlag{
+			Name:   "smoke-test.status",
+			Usage:  "status the smoke test expects, any 2xx by default",
+			EnvVar: "PLUGIN_SMOKE_TEST_STATUS",
+		},
+		cli.StringFlag{
+			Name:   "smoke-test.body",
+			Usage:  "regular expression the body of the smoke test response must match",
+			EnvVar: "PLUGIN_SMOKE_TEST_BODY",
+		},
+		cli.IntFlag{
+			Name:   "smoke-test.retries",
+			Value:  10,
+			Usage:  "how many more times to try the smoke test",
+			EnvVar: "PLUGIN_SMOKE_TEST_RETRIES",
+		},
+		cli.DurationFlag{
+			Name:   "smoke-test.interval",
+			Value:  5 * time.Second,
+			Usage:  "time between smoke test attempts",
+			EnvVar: "PLUGIN_SMOKE_TEST_INTERVAL",
+		},
+		cli.BoolFlag{
+			Name:   "smoke-test.rollback",
+			Usage:  "roll back the updated deployments when the smoke test fails",
+			EnvVar: "PLUGIN_SMOKE_TEST_ROLLBACK",
+		},
+		cli.StringFlag{
+			Name:   "metrics.pushgateway",
+			Usage:  "prometheus pushgateway url to push deploy metrics to",
+			EnvVar: "PLUGIN_METRICS_PUSHGATEWAY",
+		},
+		cli.StringFlag{
+			Name:   "metrics.job",
+			Usage:  "pushgateway job name",
+			Value:  "drone-kube",
+			EnvVar: "PLUGIN_METRICS_JOB",
+		},
+		cli.StringFlag{
+			Name:   "metrics.file",
+			Usage:  "write deploy metrics to this file in the OpenMetrics format",
+			EnvVar: "PLUGIN_METRICS_FILE",
+		},
+		cli.StringFlag{
+			Name:   "metrics.environment",
+			Usage:  "environment label of the metrics, the deployment target by default",
+			EnvVar: "PLUGIN_METRICS_ENVIRONMENT",
+		},
+		cli.StringFlag{
+			Name:   "clusters",
+			Usage:  "json list of clusters to deploy to: [{name, server, token, ca, namespace, values}]",
+			EnvVar: "PLUGIN_CLUSTERS",
+		},
+		cli.IntFlag{
+			Name:   "parallelism",
+			Value:  1,
+			Usage:  "number of clusters deployed to at the same time",
+			EnvVar: "PLUGIN_PARALLELISM",
+		},
+		cli.StringFlag{
+			Name:   "on-failure",
+			Value:  "stop",
+			Usage:  "what to do when a cluster fails: stop or continue",
+			EnvVar: "PLUGIN_ON_FAILURE",
+		},
+		cli.StringFlag{
+			Name:   "template.token",
+			Usage:  "bearer token sent when fetching templates from urls",
+			EnvVar: "TEMPLATE_TOKEN,PLUGIN_TEMPLATE_TOKEN",
+		},
+		cli.StringFlag{
+			Name:   "template.username",
+			Usage:  "basic auth username sent when fetching templates from urls",
+			EnvVar: "TEMPLATE_USERNAME,PLUGIN_TEMPLATE_USERNAME",
+		},
+		cli.StringFlag{
+			Name:   "template.password",
+			Usage:  "basic auth password sent when fetching templates from urls",
+			EnvVar: "TEMPLATE_PASSWORD,PLUGIN_TEMPLATE_PASSWORD",
+		},
+		cli.DurationFlag{
+			Name:   "template.timeout",
+			Value:  30 * time.Second,
+			Usage:  "timeout of each template download",
+			EnvVar: "PLUGIN_TEMPLATE_TIMEOUT",
+		},
+		cli.IntFlag{
+			Name:   "template.retries",
+			Value:  2,
+			Usage:  "how often a failed template download is retried",
+			EnvVar: "PLUGIN_TEMPLATE_RETRIES",
+		},
+		cli.StringFlag{
+			Name:   "template.repo",
+			Usage:  "git repository to take the templates from",
+			EnvVar: "PLUGIN_TEMPLATE_REPO",
+		},
+		cli.StringFlag{
+			Name:   "template.ref",
+			Usage:  "branch, tag or commit of the template repository",
+			EnvVar: "PLUGIN_TEMPLATE_REF",
+		},
+		cli.StringFlag{
+			Name:   "template.path",
+			Usage:  "directory, file or glob in the template repository",
+			EnvVar: "PLUGIN_TEMPLATE_PATH",
+		},
+		cli.StringFlag{
+			Name:   "template.repo.ssh-key",
+			Usage:  "private ssh key to clone the template repository with",
+			EnvVar: "TEMPLATE_REPO_SSH_KEY,PLUGIN_TEMPLATE_REPO_SSH_KEY",
+		},
+		cli.StringFlag{
+			Name:   "template.repo.known-hosts",
+			Usage:  "known_hosts entries of the template repository server",
+			EnvVar: "TEMPLATE_REPO_KNOWN_HOSTS,PLUGIN_TEMPLATE_REPO_KNOWN_HOSTS",
+		},
+		cli.StringFlag{
+			Name:   "template.repo.username",
+			Usage:  "username sent with the template repository token",
+			EnvVar: "PLUGIN_TEMPLATE_REPO_USERNAME",
+		},
+		cli.StringFlag{
+			Name:   "template.repo.token",
+			Usage:  "token to clone the template repository over https with",
+			EnvVar: "TEMPLATE_REPO_TOKEN,PLUGIN_TEMPLATE_REPO_TOKEN",
+		},
+		cli.StringFlag{
+			Name:   "partials",
+			Usage:  "directory of *.yaml or *.hbs files usable as {{> name}} in templates",
+			EnvVar: "PLUGIN_PARTIALS",
+		},
+		cli.StringSliceFlag{
+			Name:   "sensitive",
+			Usage:  "environment variables whose values are masked in the build logs",
+			EnvVar: "PLUGIN_SENSITIVE",
+		},
+		cli.StringFlag{
+			Name:   "decryption-key",
+			Usage:  "age or PGP private keys for sops documents and encrypted values",
+			EnvVar: "PLUGIN_DECRYPTION_KEY",
+		},
+		cli.StringFlag{
+			Name:   "decryption-passphrase",
+			Usage:  "passphrase of the PGP private key",
+			EnvVar: "PLUGIN_DECRYPTION_PASSPHRASE",
+		},
+		cli.StringFlag{
+			Name:   "kustomize",
+			Usage:  "kustomization directory to build and apply: k8s/overlays/production",
+			EnvVar: "PLUGIN_KUSTOMIZE",
+		},
 		cli.StringFlag{
 			Name:   "repo.owner",
 			Usage:  "repository owner",
@@ -63,6 +415,11 @@ func main() {
 			Usage:  "repository name",
 			EnvVar: "DRONE_REPO_NAME",
 		},
+		cli.StringFlag{
+			Name:   "repo.remote",
+			Usage:  "repository clone url",
+			EnvVar: "DRONE_REMOTE_URL,DRONE_GIT_HTTP_URL",
+		},
 		cli.StringFlag{
 			Name:   "commit.sha",
 			Usage:  "git commit sha",
@@ -85,6 +442,46 @@ func main() {
 			Usage:  "git author name",
 			EnvVar: "DRONE_COMMIT_AUTHOR",
 		},
+		cli.StringFlag{
+			Name:   "commit.author.email",
+			Usage:  "git author email",
+			EnvVar: "DRONE_COMMIT_AUTHOR_EMAIL",
+		},
+		cli.StringFlag{
+			Name:   "commit.author.avatar",
+			Usage:  "git author avatar",
+			EnvVar: "DRONE_COMMIT_AUTHOR_AVATAR",
+		},
+		cli.StringFlag{
+			Name:   "commit.message",
+			Usage:  "git commit message",
+			EnvVar: "DRONE_COMMIT_MESSAGE",
+		},
+		cli.StringFlag{
+			Name:   "commit.source-branch",
+			Usage:  "source branch of a pull request",
+			EnvVar: "DRONE_SOURCE_BRANCH",
+		},
+		cli.StringFlag{
+			Name:   "commit.target-branch",
+			Usage:  "target branch of a pull request",
+			EnvVar: "DRONE_TARGET_BRANCH",
+		},
+		cli.IntFlag{
+			Name:   "pull-request",
+			Usage:  "pull request number",
+			EnvVar: "DRONE_PULL_REQUEST",
+		},
+		cli.StringFlag{
+			Name:   "build.deploy-to",
+			Usage:  "deployment target",
+			EnvVar: "DRONE_DEPLOY_TO",
+		},
+		cli.IntFlag{
+			Name:   "build.parent",
+			Usage:  "number of the build this one was promoted or restarted from",
+			EnvVar: "DRONE_BUILD_PARENT",
+		},
 		cli.StringFlag{
 			Name:   "build.event",
 			Value:  "push",
@@ -122,6 +519,34 @@ func main() {
 			Usage:  "build tag",
 			EnvVar: "DRONE_TAG",
 		},
+		cli.Int64Flag{
+			Name:   "job.started",
+			Usage:  "job started",
+			EnvVar: "DRONE_JOB_STARTED",
+		},
+		cli.StringFlag{
+			Name:   "stage.name",
+			Usage:  "pipeline stage name",
+			EnvVar: "DRONE_STAGE_NAME",
+		},
+		cli.StringFlag{
+			Name:   "step.name",
+			Usage:  "pipeline step name",
+			EnvVar: "DRONE_STEP_NAME",
+		},
+		cli.StringFlag{
+			Name:   "env-file",
+			Usage:  "source env file, loaded before the other settings are read",
+			EnvVar: "PLUGIN_ENV_FILE",
+		},
+	}
+
+	// the env file has to be loaded before app.Run, which reads the EnvVar
+	// of every flag up front
+	if file := envFile(os.Args[1:]); file != "" {
+		if err := godotenv.Load(file); err != nil {
+			log.Fatal(errors.Wrap(err, "failed to load env file"))
+		}
 	}
 
 	if err := app.Run(os.Args); err != nil {
@@ -129,44 +554,220 @@ func main() {
 	}
 }
 
+// envFile returns the env-file flag from args, or PLUGIN_ENV_FILE if the
+// flag is not given.
+func envFile(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name := strings.TrimLeft(arg, "-")
+		if name == arg {
+			continue
+		}
+		if name == "env-file" && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(name, "env-file=") {
+			return strings.TrimPrefix(name, "env-file=")
+		}
+	}
+	return os.Getenv("PLUGIN_ENV_FILE")
+}
+
 func run(c *cli.Context) error {
+	plugin, err := newPlugin(c)
+	if err != nil {
+		return err
+	}
+	if c.Bool("render-only") {
+		return renderRedacted(plugin)
+	}
+	return plugin.Exec()
+}
+
+// render prints the manifests instead of applying them, without a cluster.
+func render(c *cli.Context) error {
+	plugin, err := newPlugin(c.Parent())
+	if err != nil {
+		return err
+	}
+	return renderRedacted(plugin)
+}
+
+// renderRedacted prints the manifests to stdout with the secrets masked.
+func renderRedacted(plugin *Plugin) error {
+	out := util.DefaultRedactor.Writer(os.Stdout)
+	if err := plugin.Render(out); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func newPlugin(c *cli.Context) (*Plugin, error) {
 	// kubernetes token
 
-	if c.String("env-file") != "" {
-		_ = godotenv.Load(c.String("env-file"))
+	var clusters []util.Cluster
+	if c.String("clusters") != "" {
+		if err := json.Unmarshal([]byte(c.String("clusters")), &clusters); err != nil {
+			return nil, errors.Wrap(err, "invalid clusters")
+		}
 	}
 
-	plugin := Plugin{
+	plugin := &Plugin{
 		Repo: Repo{
-			Owner: c.String("repo.owner"),
-			Name:  c.String("repo.name"),
+			Owner:  c.String("repo.owner"),
+			Name:   c.String("repo.name"),
+			Remote: c.String("repo.remote"),
 		},
 		Build: Build{
-			Tag:     c.String("build.tag"),
-			Number:  c.Int("build.number"),
-			Event:   c.String("build.event"),
-			Status:  c.String("build.status"),
-			Commit:  c.String("commit.sha"),
-			Ref:     c.String("commit.ref"),
-			Branch:  c.String("commit.branch"),
-			Author:  c.String("commit.author"),
-			Link:    c.String("build.link"),
-			Started: c.Int64("build.started"),
-			Created: c.Int64("build.created"),
+			Tag:          c.String("build.tag"),
+			Number:       c.Int("build.number"),
+			Parent:       c.Int("build.parent"),
+			Event:        c.String("build.event"),
+			Status:       c.String("build.status"),
+			Commit:       c.String("commit.sha"),
+			Ref:          c.String("commit.ref"),
+			Branch:       c.String("commit.branch"),
+			SourceBranch: c.String("commit.source-branch"),
+			TargetBranch: c.String("commit.target-branch"),
+			PullRequest:  c.Int("pull-request"),
+			DeployTo:     c.String("build.deploy-to"),
+			Message:      c.String("commit.message"),
+			Author:       c.String("commit.author"),
+			Email:        c.String("commit.author.email"),
+			Avatar:       c.String("commit.author.avatar"),
+			Link:         c.String("build.link"),
+			Started:      c.Int64("build.started"),
+			Created:      c.Int64("build.created"),
+			Semver:       util.ParseSemver(c.String("build.tag")),
 		},
 		Job: Job{
 			Started: c.Int64("job.started"),
 		},
+		Stage: Stage{
+			Name: c.String("stage.name"),
+		},
+		Step: Step{
+			Name: c.String("step.name"),
+		},
 		Config: util.Config{
+			Action:    c.String("action"),
 			Token:     c.String("token"),
 			Server:    c.String("server"),
 			Ca:        c.String("ca"),
 			Namespace: c.String("namespace"),
-			Template:  c.String("template"),
+			Template:  c.StringSlice("template"),
 			Service:   c.String("service"),
 			Ingress:   c.String("ingress"),
+			Kustomize: c.String("kustomize"),
+			Partials:  c.String("partials"),
+
+			DecryptionKey:        c.String("decryption-key"),
+			DecryptionPassphrase: c.String("decryption-passphrase"),
+
+			TemplateToken:    c.String("template.token"),
+			TemplateUsername: c.String("template.username"),
+			TemplatePassword: c.String("template.password"),
+			TemplateTimeout:  c.Duration("template.timeout"),
+			TemplateRetries:  c.Int("template.retries"),
+
+			TemplateRepo:           c.String("template.repo"),
+			TemplateRef:            c.String("template.ref"),
+			TemplatePath:           c.String("template.path"),
+			TemplateRepoSSHKey:     c.String("template.repo.ssh-key"),
+			TemplateRepoKnownHosts: c.String("template.repo.known-hosts"),
+			TemplateRepoUsername:   c.String("template.repo.username"),
+			TemplateRepoToken:      c.String("template.repo.token"),
+
+			PinDigests:       c.Bool("pin-digests"),
+			Registry:         c.String("registry"),
+			RegistryUsername: c.String("registry.username"),
+			RegistryPassword: c.String("registry.password"),
+			RegistryInsecure: c.Bool("registry.insecure"),
+
+			Policy:           c.StringSlice("policy"),
+			PolicyRegistries: c.StringSlice("policy.registries"),
+			PolicyRules:      c.StringSlice("policy.rules"),
+			PolicyWarn:       c.Bool("policy.warn"),
+
+			Restart:    c.StringSlice("restart"),
+			ConfigHash: c.Bool("config-hash"),
+			Provenance: c.Bool("provenance"),
+			Events:     c.Bool("events"),
+			Wait:       c.Bool("wait"),
+			WaitFor:    c.StringSlice("wait-for"),
+			Timeout:    c.Duration("timeout"),
+
+			RetryAttempts: c.Int("retry.attempts"),
+			RetryDeadline: c.Duration("retry.deadline"),
+
+			Deployments: c.StringSlice("deployments"),
+			Replicas:    int32(c.Int("replicas")),
+			ReplicasSet: c.IsSet("replicas"),
+			Propagation: c.String("propagation"),
+
+			CreateNamespace:      c.Bool("create-namespace"),
+			NamespaceLabels:      keyValues(c.StringSlice("namespace.labels")),
+			NamespaceAnnotations: keyValues(c.StringSlice("namespace.annotations")),
+			NamespaceQuota:       keyValues(c.StringSlice("namespace.quota")),
+			NamespaceLimits:      keyValues(c.StringSlice("namespace.limits")),
+			NamespaceRequests:    keyValues(c.StringSlice("namespace.requests")),
+
+			NotifyWebhook:  c.StringSlice("notify-webhook"),
+			NotifyTemplate: c.String("notify-template"),
+			NotifyOn:       c.StringSlice("notify-on"),
+			NotifyHeaders:  keyValues(c.StringSlice("notify-headers")),
+			NotifyRetries:  c.Int("notify-retries"),
+
+			SmokeTest:         c.String("smoke-test"),
+			SmokeTestStatus:   c.Int("smoke-test.status"),
+			SmokeTestBody:     c.String("smoke-test.body"),
+			SmokeTestRetries:  c.Int("smoke-test.retries"),
+			SmokeTestInterval: c.Duration("smoke-test.interval"),
+			SmokeTestRollback: c.Bool("smoke-test.rollback"),
+
+			ReportFile: c.String("report-file"),
+
+			MetricsPushgateway: c.String("metrics.pushgateway"),
+			MetricsJob:         c.String("metrics.job"),
+			MetricsFile:        c.String("metrics.file"),
+			MetricsEnvironment: c.String("metrics.environment"),
+
+			Clusters:    clusters,
+			Parallelism: c.Int("parallelism"),
+			OnFailure:   c.String("on-failure"),
 		},
 	}
 
-	return plugin.Exec()
+	cfg := plugin.Config
+	util.DefaultFetcher = util.NewFetcher(cfg)
+	util.Sensitive(cfg.Token, cfg.TemplateToken, cfg.TemplatePassword, cfg.TemplateRepoSSHKey, cfg.TemplateRepoToken,
+		cfg.RegistryPassword, cfg.DecryptionKey, cfg.DecryptionPassphrase)
+	// webhook urls usually hold a token
+	util.Sensitive(cfg.NotifyWebhook...)
+	util.Sensitive(cfg.NotifyHeaders["Authorization"])
+	for _, name := range c.StringSlice("sensitive") {
+		util.SensitiveText(os.Getenv(name))
+	}
+
+	return plugin, nil
+}
+
+// turn a list of key=value settings into a map.
+func keyValues(list []string) map[string]string {
+	if len(list) == 0 {
+		return nil
+	}
+	m := map[string]string{}
+	for _, kv := range list {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) == 2 {
+			m[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		} else {
+			m[strings.TrimSpace(parts[0])] = ""
+		}
+	}
+	return m
 }
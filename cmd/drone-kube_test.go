@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joho/godotenv"
+	"github.com/urfave/cli"
+)
+
+func TestEnvFile(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  string
+		want string
+	}{
+		{name: "separate value", args: []string{"--env-file", "a.env"}, want: "a.env"},
+		{name: "equals", args: []string{"--namespace", "shop", "--env-file=b.env"}, want: "b.env"},
+		{name: "single dash", args: []string{"-env-file", "c.env"}, want: "c.env"},
+		{name: "flag wins", args: []string{"--env-file", "d.env"}, env: "e.env", want: "d.env"},
+		{name: "from env", args: []string{"--namespace", "shop"}, env: "e.env", want: "e.env"},
+		{name: "after terminator", args: []string{"--", "--env-file", "f.env"}, want: ""},
+		{name: "none", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PLUGIN_ENV_FILE", tt.env)
+			if got := envFile(tt.args); got != tt.want {
+				t.Errorf("envFile(%q) = %q, want %q", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+// The values of the env file must reach the flags, which urfave/cli reads
+// from the environment when the app runs.
+func TestEnvFileReachesFlags(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "plugin.env")
+	if err := ioutil.WriteFile(file, []byte("PLUGIN_NAMESPACE=shop\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PLUGIN_NAMESPACE", "")
+	os.Unsetenv("PLUGIN_NAMESPACE")
+
+	args := []string{"drone-kube", "--env-file", file}
+	if err := godotenv.Load(envFile(args[1:])); err != nil {
+		t.Fatal(err)
+	}
+
+	var got string
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{
+		cli.StringFlag{Name: "namespace", EnvVar: "PLUGIN_NAMESPACE"},
+		cli.StringFlag{Name: "env-file", EnvVar: "PLUGIN_ENV_FILE"},
+	}
+	app.Action = func(c *cli.Context) error {
+		got = c.String("namespace")
+		return nil
+	}
+	if err := app.Run(args); err != nil {
+		t.Fatal(err)
+	}
+	if got != "shop" {
+		t.Errorf("namespace %q, want shop", got)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/goerzh/drone-kube/item"
+	"github.com/goerzh/drone-kube/util"
+	"k8s.io/client-go/kubernetes"
+)
+
+// recordEvents records an event on every object apply got to, failing to
+// only logs as the deploy itself is done.
+func (p *Plugin) recordEvents(results []item.Result, clientset *kubernetes.Clientset) {
+	if !p.Config.Events {
+		return
+	}
+	for _, r := range results {
+		if err := item.RecordEvent(r, p.eventMessage(r), item.NewRetryPolicy(p.Config), clientset); err != nil {
+			log.Println(err.Error())
+		}
+	}
+}
+
+// eventMessage tells which build did what, e.g.
+// `drone build #42 of goerzh/app (9f2c1e0a) updated the deployment: https://drone/42`.
+func (p *Plugin) eventMessage(r item.Result) string {
+	commit := p.Build.Commit
+	if len(commit) > 8 {
+		commit = commit[:8]
+	}
+	msg := fmt.Sprintf("drone build #%d of %s/%s (%s) ", p.Build.Number, p.Repo.Owner, p.Repo.Name, commit)
+	if r.Action == item.ActionFailed {
+		msg += "failed to apply the " + strings.ToLower(r.Kind) + ": " + util.Redact(r.Error)
+	} else {
+		msg += r.Action + " the " + strings.ToLower(r.Kind)
+	}
+	if p.Build.Link != "" {
+		msg += ": " + p.Build.Link
+	}
+	return msg
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/goerzh/drone-kube/item"
+	"github.com/goerzh/drone-kube/util"
+	"github.com/pkg/errors"
+)
+
+// metrics turns the report into gauges, one series per cluster deployed to.
+func (p *Plugin) metrics() *util.Metrics {
+	repo := p.Repo.Owner + "/" + p.Repo.Name
+	environment := p.metricsEnvironment()
+
+	m := &util.Metrics{}
+	for _, run := range p.report.runs {
+		cluster := run.cluster
+		if cluster == "" {
+			// a single cluster has no name, its server stands in
+			if u, err := url.Parse(p.Config.Server); err == nil {
+				cluster = u.Host
+			}
+		}
+		labels := func(extra ...string) map[string]string {
+			l := map[string]string{
+				"repo":        repo,
+				"namespace":   run.namespace,
+				"cluster":     cluster,
+				"environment": environment,
+			}
+			for i := 0; i+1 < len(extra); i += 2 {
+				l[extra[i]] = extra[i+1]
+			}
+			return l
+		}
+
+		success := 1.0
+		if run.err != nil {
+			success = 0
+		}
+		m.Set("drone_kube_deploy_duration_seconds", "Time the deploy took.", labels(), run.duration.Seconds())
+		m.Set("drone_kube_deploy_success", "Whether the deploy succeeded, 1 or 0.", labels(), success)
+		m.Set("drone_kube_deploy_timestamp_seconds", "Unix time the deploy started.", labels(), float64(run.started.UnixNano())/float64(time.Second))
+
+		rollout := 0.0
+		counts := map[string]int{}
+		for _, o := range p.report.objects {
+			if o.Cluster != run.cluster {
+				continue
+			}
+			rollout += o.RolloutSeconds
+			counts[o.Action]++
+		}
+		m.Set("drone_kube_rollout_wait_seconds", "Time spent waiting for rollouts.", labels(), rollout)
+		for _, action := range []string{item.ActionCreated, item.ActionUpdated, item.ActionUnchanged, item.ActionDeleted, item.ActionAbsent, item.ActionFailed} {
+			m.Set("drone_kube_objects", "Objects by the action taken on them.", labels("action", action), float64(counts[action]))
+		}
+	}
+	return m
+}
+
+// metricsEnvironment is the environment label, the deployment target unless
+// set.
+func (p *Plugin) metricsEnvironment() string {
+	if p.Config.MetricsEnvironment != "" {
+		return p.Config.MetricsEnvironment
+	}
+	return p.Build.DeployTo
+}
+
+// writeMetrics pushes the metrics to the pushgateway and writes them to the
+// metrics file, whichever are set.
+func (p *Plugin) writeMetrics() error {
+	if p.Config.MetricsPushgateway == "" && p.Config.MetricsFile == "" {
+		return nil
+	}
+	m := p.metrics()
+
+	if p.Config.MetricsFile != "" {
+		var buf bytes.Buffer
+		if err := m.WriteTo(&buf, true); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(p.Config.MetricsFile, buf.Bytes(), 0644); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	if p.Config.MetricsPushgateway != "" {
+		hook := &util.Webhook{Client: &http.Client{Timeout: 10 * time.Second}, Retries: 2}
+		grouping := map[string]string{
+			"repo":        p.Repo.Owner + "/" + p.Repo.Name,
+			"environment": p.metricsEnvironment(),
+		}
+		if err := m.Push(hook, p.Config.MetricsPushgateway, p.Config.MetricsJob, grouping); err != nil {
+			return err
+		}
+	}
+	return nil
+}
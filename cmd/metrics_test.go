@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/goerzh/drone-kube/item"
+	"github.com/goerzh/drone-kube/util"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestWriteMetrics(t *testing.T) {
+	started := time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC)
+	p := &Plugin{
+		Config: util.Config{
+			Server:      "https://10.0.0.1:6443",
+			MetricsFile: filepath.Join(t.TempDir(), "metrics.txt"),
+		},
+		report: &report{
+			runs: []clusterRun{
+				{namespace: "shop", started: started, duration: 95 * time.Second},
+				{cluster: "us", namespace: "shop", started: started, duration: 2500 * time.Millisecond, err: errors.New("boom")},
+			},
+			objects: []reportObject{
+				{Result: item.Result{Kind: "Deployment", Name: "web", Action: item.ActionUpdated, RolloutSeconds: 41.5}},
+				{Result: item.Result{Kind: "Service", Name: "web", Action: item.ActionUnchanged}},
+				{Result: item.Result{Kind: "ConfigMap", Name: "web", Action: item.ActionCreated}},
+				{Cluster: "us", Result: item.Result{Kind: "Deployment", Name: "web", Action: item.ActionFailed}},
+			},
+		},
+	}
+	p.Repo.Owner, p.Repo.Name = "goerzh", "app"
+	p.Build.DeployTo = "production"
+
+	if err := p.writeMetrics(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(p.Config.MetricsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join("testdata", "metrics.golden")
+	if *update {
+		if err = ioutil.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/goerzh/drone-kube/util"
+)
+
+// outcomes a notification can be sent for
+const (
+	notifyStarted = "started"
+	notifySuccess = "success"
+	notifyFailure = "failure"
+)
+
+// payload sent when there is no notify_template, understood by Slack and
+// Microsoft Teams incoming webhooks
+const defaultNotifyTemplate = `{"text": {{toJson text}} }`
+
+// notification is what the payload template is rendered with.
+type notification struct {
+	Event     string
+	Error     string
+	Text      string
+	Action    string
+	Namespace string
+	Images    []string
+	Repo      Repo
+	Build     Build
+	Job       Job
+	Stage     Stage
+	Step      Step
+	Cluster   Cluster
+}
+
+// notify posts the outcome to every webhook that wants it. Failing to notify
+// is logged but does not fail the build.
+func (p *Plugin) notify(event string, runErr error) {
+	if len(p.Config.NotifyWebhook) == 0 || !p.notifyOn(event) {
+		return
+	}
+
+	n := notification{
+		Event:     event,
+		Action:    p.Config.Action,
+		Namespace: p.Config.Namespace,
+		Images:    p.images,
+		Repo:      p.Repo,
+		Build:     p.Build,
+		Job:       p.Job,
+		Stage:     p.Stage,
+		Step:      p.Step,
+		Cluster:   p.Cluster,
+	}
+	if runErr != nil {
+		n.Error = runErr.Error()
+	}
+	n.Text = p.notifyText(event, n.Error)
+
+	tpl := p.Config.NotifyTemplate
+	if tpl == "" {
+		tpl = defaultNotifyTemplate
+	}
+	payload, err := util.Render(tpl, n)
+	if err != nil {
+		log.Println("cannot render notification: " + err.Error())
+		return
+	}
+	// the error may quote anything
+	payload = util.Redact(payload)
+
+	hook := &util.Webhook{
+		Client:  &http.Client{Timeout: 10 * time.Second},
+		Headers: p.Config.NotifyHeaders,
+		Retries: p.Config.NotifyRetries,
+	}
+	for _, endpoint := range p.Config.NotifyWebhook {
+		if err = hook.Post(endpoint, []byte(payload)); err != nil {
+			log.Println("cannot send notification: " + err.Error())
+		}
+	}
+}
+
+// notifyOn tells whether notifications are wanted for the event, all of
+// them are by default.
+func (p *Plugin) notifyOn(event string) bool {
+	if len(p.Config.NotifyOn) == 0 {
+		return true
+	}
+	for _, e := range p.Config.NotifyOn {
+		if strings.TrimSpace(e) == event {
+			return true
+		}
+	}
+	return false
+}
+
+// notifyText is a one line summary, like
+// `deployed goerzh/app #42 (master 9f2c1e0a) to default on cluster eu`.
+func (p *Plugin) notifyText(event, errText string) string {
+	build := fmt.Sprintf("%s/%s #%d", p.Repo.Owner, p.Repo.Name, p.Build.Number)
+	version := p.Build.Tag
+	if version == "" {
+		version = p.Build.Branch
+	}
+	commit := p.Build.Commit
+	if len(commit) > 8 {
+		commit = commit[:8]
+	}
+	if v := strings.TrimSpace(version + " " + commit); v != "" {
+		build += " (" + v + ")"
+	}
+	target := p.Config.Namespace
+	if p.Cluster.Name != "" {
+		target += " on cluster " + p.Cluster.Name
+	}
+
+	var text string
+	switch {
+	case p.Config.Action != "apply":
+		text = fmt.Sprintf("%s of %s in %s", p.Config.Action, build, target)
+		if event == notifyStarted {
+			text += " started"
+		} else if event == notifySuccess {
+			text += " succeeded"
+		}
+	case event == notifyStarted:
+		text = fmt.Sprintf("deploying %s to %s", build, target)
+	case event == notifySuccess:
+		text = fmt.Sprintf("deployed %s to %s", build, target)
+	default:
+		text = fmt.Sprintf("deploy of %s to %s", build, target)
+	}
+	if event == notifyFailure {
+		text += " failed: " + errText
+	}
+	if len(p.images) > 0 {
+		text += "\n" + strings.Join(p.images, ", ")
+	}
+	if p.Build.Link != "" {
+		text += "\n" + p.Build.Link
+	}
+	return text
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/goerzh/drone-kube/util"
+)
+
+// notifyServer collects the payloads posted to it.
+func notifyServer(t *testing.T) (*httptest.Server, *[]string) {
+	var payloads []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("method %s", r.Method)
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		payloads = append(payloads, string(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &payloads
+}
+
+func notifyPlugin(endpoint string) *Plugin {
+	p := &Plugin{Config: util.Config{Action: "apply", Namespace: "shop", NotifyWebhook: []string{endpoint}}}
+	p.Repo.Owner, p.Repo.Name = "goerzh", "app"
+	p.Build.Number, p.Build.Branch, p.Build.Commit = 42, "master", "9f2c1e0a7b"
+	p.Cluster.Name = "eu"
+	p.images = []string{"app:1.2"}
+	return p
+}
+
+func TestNotifyDefaultTemplate(t *testing.T) {
+	srv, payloads := notifyServer(t)
+	notifyPlugin(srv.URL).notify(notifySuccess, nil)
+
+	if len(*payloads) != 1 {
+		t.Fatalf("got %d notifications, want 1", len(*payloads))
+	}
+	var payload struct{ Text string }
+	if err := json.Unmarshal([]byte((*payloads)[0]), &payload); err != nil {
+		t.Fatalf("%s: %v", (*payloads)[0], err)
+	}
+	if want := "deployed goerzh/app #42 (master 9f2c1e0a) to shop on cluster eu\napp:1.2"; payload.Text != want {
+		t.Errorf("got %q, want %q", payload.Text, want)
+	}
+}
+
+func TestNotifyTemplate(t *testing.T) {
+	srv, payloads := notifyServer(t)
+	p := notifyPlugin(srv.URL)
+	p.Config.NotifyTemplate = `{{Event}} {{Repo.Name}} #{{Build.Number}} {{Namespace}} {{Cluster.Name}} {{#each Images}}{{this}}{{/each}}: {{Error}}`
+	util.Sensitive("hunter2-token")
+	p.notify(notifyFailure, errors.New("cannot log in with hunter2-token"))
+
+	want := "failure app #42 shop eu app:1.2: cannot log in with *****"
+	if len(*payloads) != 1 || (*payloads)[0] != want {
+		t.Errorf("got %q, want %q", *payloads, want)
+	}
+}
+
+func TestNotifyOn(t *testing.T) {
+	srv, payloads := notifyServer(t)
+	p := notifyPlugin(srv.URL)
+	p.Config.NotifyTemplate = `{{Event}}`
+	p.Config.NotifyOn = []string{"failure", " success"}
+
+	p.notify(notifyStarted, nil)
+	p.notify(notifySuccess, nil)
+	p.notify(notifyFailure, errors.New("boom"))
+
+	if got := *payloads; len(got) != 2 || got[0] != "success" || got[1] != "failure" {
+		t.Errorf("got %q, want [success failure]", got)
+	}
+}
@@ -4,124 +4,365 @@ import (
 	"bytes"
 	"encoding/base64"
 	"github.com/goerzh/drone-kube/item"
+	"github.com/goerzh/drone-kube/registry"
+	"github.com/goerzh/drone-kube/secret"
 	"github.com/goerzh/drone-kube/util"
 	"github.com/pkg/errors"
-	"io/ioutil"
 	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 	"log"
+	"time"
 )
 
 type (
 	Repo struct {
-		Owner string
-		Name  string
+		Owner  string
+		Name   string
+		Remote string
 	}
 
 	Build struct {
-		Tag     string
-		Event   string
-		Number  int
-		Commit  string
-		Ref     string
-		Branch  string
-		Author  string
-		Status  string
-		Link    string
-		Started int64
-		Created int64
+		Tag          string
+		Event        string
+		Number       int
+		Parent       int
+		Commit       string
+		Ref          string
+		Branch       string
+		SourceBranch string
+		TargetBranch string
+		PullRequest  int
+		DeployTo     string
+		Message      string
+		Author       string
+		Email        string
+		Avatar       string
+		Status       string
+		Link         string
+		Started      int64
+		Created      int64
+		Semver       *util.Semver
 	}
 
 	Job struct {
 		Started int64
 	}
 
-	Plugin struct {
-		Repo   Repo
-		Build  Build
-		Config util.Config
-		Job    Job
+	Stage struct {
+		Name string
 	}
-)
 
-func (p *Plugin) Exec() error {
+	Step struct {
+		Name string
+	}
+
+	// Cluster is the fan-out target being deployed to, empty for a single cluster.
+	Cluster struct {
+		Name   string
+		Values map[string]interface{}
+	}
+
+	Plugin struct {
+		Repo    Repo
+		Build   Build
+		Config  util.Config
+		Job     Job
+		Stage   Stage
+		Step    Step
+		Cluster Cluster
+
+		// shared with the copies made per cluster
+		report *report
 
-	if p.Config.Server == "" {
-		log.Fatal("KUBE_SERVER is not defined")
+		// images being deployed, for notifications
+		images []string
 	}
-	if p.Config.Token == "" {
-		log.Fatal("KUBE_TOKEN is not defined")
+)
+
+func (p *Plugin) Exec() (err error) {
+	if p.Config.ReportFile != "" || p.Config.MetricsPushgateway != "" || p.Config.MetricsFile != "" {
+		p.report = &report{}
+		started := time.Now()
+		defer func() {
+			if p.Config.ReportFile != "" {
+				if werr := p.writeReport(started, err); werr != nil {
+					log.Println("cannot write report: " + werr.Error())
+				}
+			}
+			if werr := p.writeMetrics(); werr != nil {
+				log.Println("cannot write metrics: " + werr.Error())
+			}
+		}()
 	}
-	if p.Config.Ca == "" {
-		log.Fatal("KUBE_CA is not defined")
+
+	if len(p.Config.Clusters) == 0 {
+		if p.Config.Server == "" {
+			return errors.New("KUBE_SERVER is not defined")
+		}
+		if p.Config.Token == "" {
+			return errors.New("KUBE_TOKEN is not defined")
+		}
+		if p.Config.Ca == "" {
+			return errors.New("KUBE_CA is not defined")
+		}
 	}
 	if p.Config.Namespace == "" {
 		p.Config.Namespace = "default"
 	}
-	if p.Config.Template == "" {
-		log.Fatal("KUBE_TEMPLATE or template must be defined")
+	if p.Config.Action == "" {
+		p.Config.Action = "apply"
+	}
+	hasInput := len(p.Config.Template) > 0 || p.Config.TemplateRepo != "" || p.Config.Kustomize != ""
+	if p.Config.Action == "apply" && !hasInput && len(p.Config.Restart) == 0 {
+		return errors.New("KUBE_TEMPLATE, template, template_repo or kustomize must be defined")
+	}
+	if p.Config.Action == "delete" && !hasInput && len(p.Config.Deployments) == 0 {
+		return errors.New("KUBE_TEMPLATE, template, template_repo, kustomize or deployments must be defined for action delete")
+	}
+	if p.Config.Action != "apply" && p.Config.Action != "delete" && len(p.Config.Deployments) == 0 {
+		return errors.New("deployments must be defined for action " + p.Config.Action)
 	}
+	// an unset replicas would scale to 0
+	if p.Config.Action == "scale" && !p.Config.ReplicasSet {
+		return errors.New("replicas must be defined for action scale")
+	}
+
+	if p.Config.Partials != "" {
+		if err := util.LoadPartials(p.Config.Partials); err != nil {
+			return errors.Wrap(err, "cannot load partials")
+		}
+	}
+
+	if len(p.Config.Clusters) > 0 {
+		return p.fanOut()
+	}
+	return p.run()
+}
+
+// run performs the action against the configured cluster, notifying of
+// its outcome.
+func (p *Plugin) run() (err error) {
+	if err = p.renderNamespace(); err != nil {
+		return err
+	}
+	started := time.Now()
+	defer func() {
+		p.recordRun(started, err)
+		if err != nil {
+			p.notify(notifyFailure, err)
+		} else {
+			p.notify(notifySuccess, nil)
+		}
+	}()
 
 	// connect to Kubernetes
 	clientset, err := p.createKubeClient()
 	if err != nil {
-		log.Fatal(err.Error())
+		return errors.WithStack(err)
 	}
 
-	patch, err := openAndSub(p.Config.Template, p)
+	switch p.Config.Action {
+	case "apply":
+		return p.apply(clientset)
+	case "delete":
+		return p.delete(clientset)
+	case "scale", "pause", "resume", "restart", "status":
+		return p.operate(clientset)
+	}
+	return errors.Errorf("unknown action %q", p.Config.Action)
+}
+
+// the namespace may be a template like preview-{{ build.branch }}
+func (p *Plugin) renderNamespace() error {
+	if p.Config.Namespace == "" {
+		p.Config.Namespace = "default"
+	}
+	ns, err := util.RenderTrim(p.Config.Namespace, p)
 	if err != nil {
-		return errors.WithStack(err)
+		return errors.Wrap(err, "cannot render namespace")
+	}
+	p.Config.Namespace = util.DNS1123(ns)
+	if p.Config.Namespace == "" {
+		return errors.Errorf("namespace %q is not a valid name", ns)
+	}
+	return nil
+}
+
+// apply renders the templates and creates or updates everything they describe.
+func (p *Plugin) apply(clientset *kubernetes.Clientset) error {
+	var err error
+
+	if p.Config.CreateNamespace {
+		if err = item.EnsureNamespace(p.Config, clientset); err != nil {
+			return errors.WithStack(err)
+		}
 	}
-	dep, err := item.NewDeployment(patch, p.Config)
+
+	objects, err := p.render()
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	if err = dep.Apply(clientset); err != nil {
-		return errors.WithStack(err)
+	if len(objects.Data) > 0 {
+		if err = p.checkPolicy(objects); err != nil {
+			return errors.WithStack(err)
+		}
+		if p.Config.PinDigests {
+			if err = objects.PinImages(p.createResolver(), clientset); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		if p.Config.ConfigHash {
+			if err = objects.HashConfig(clientset); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		if p.Config.Provenance {
+			if err = objects.Annotate(p.provenance(time.Now())); err != nil {
+				return errors.WithStack(err)
+			}
+		}
 	}
 
-	// apply service
-	if p.Config.Service != "" {
-		patch, err = openAndSub(p.Config.Service, p)
+	p.images = objects.Images()
+	p.notify(notifyStarted, nil)
+
+	var revisions []deploymentRevision
+	if p.Config.SmokeTest != "" && p.Config.SmokeTestRollback {
+		revisions = p.revisions(objects, clientset)
+	}
+
+	if len(objects.Data) > 0 {
+		dynamicClient, err := p.createDynamicClient()
 		if err != nil {
 			return errors.WithStack(err)
 		}
-		svc, err := item.NewService(patch, p.Config)
+		mapper := item.NewRESTMapper(clientset)
+		err = objects.Apply(dynamicClient, mapper)
+		p.recordEvents(objects.Results, clientset)
+		if err == nil && len(p.Config.WaitFor) > 0 {
+			err = objects.WaitReady(p.Config.WaitFor, p.Config.Timeout, dynamicClient, mapper)
+		}
+		p.record(objects.Results...)
 		if err != nil {
 			return errors.WithStack(err)
 		}
+	}
 
-		err = svc.Apply(clientset)
+	// restart deployments whose manifests did not change
+	for _, name := range p.Config.Restart {
+		err = item.Restart(name, p.Config.Namespace, item.NewRetryPolicy(p.Config), clientset)
+		p.recordDeployment(name, operated["restart"], err)
 		if err != nil {
 			return errors.WithStack(err)
 		}
 	}
+	if p.Config.Wait {
+		for _, name := range p.Config.Restart {
+			if err = p.waitRollout(name, clientset); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
 
-	//apply ingress
-	if p.Config.Ingress != "" {
-		patch, err = openAndSub(p.Config.Ingress, p)
-		if err != nil {
+	if p.Config.SmokeTest != "" {
+		if err = p.smokeTest(clientset); err != nil {
+			if p.Config.SmokeTestRollback {
+				if rerr := p.rollback(revisions, clientset); rerr != nil {
+					log.Println(rerr.Error())
+				}
+			}
 			return errors.WithStack(err)
 		}
-		svc, err := item.NewIngress(patch, p.Config)
+	}
+
+	return err
+}
+
+// operate runs a day-2 action against the named deployments.
+func (p *Plugin) operate(clientset *kubernetes.Clientset) error {
+	p.notify(notifyStarted, nil)
+	ns := p.Config.Namespace
+	retry := item.NewRetryPolicy(p.Config)
+	for _, name := range p.Config.Deployments {
+		var err error
+		switch p.Config.Action {
+		case "scale":
+			err = item.Scale(name, ns, p.Config.Replicas, retry, clientset)
+		case "pause":
+			err = item.Pause(name, ns, retry, clientset)
+		case "resume":
+			err = item.Resume(name, ns, retry, clientset)
+		case "restart":
+			err = item.Restart(name, ns, retry, clientset)
+		case "status":
+			err = item.Status(name, ns, clientset)
+		}
+		p.recordDeployment(name, operated[p.Config.Action], err)
 		if err != nil {
 			return errors.WithStack(err)
 		}
+	}
+
+	if p.Config.Wait {
+		switch p.Config.Action {
+		case "scale", "resume", "restart":
+			for _, name := range p.Config.Deployments {
+				if err := p.waitRollout(name, clientset); err != nil {
+					return errors.WithStack(err)
+				}
+			}
+		}
+	}
 
-		err = svc.Apply(clientset)
+	return nil
+}
+
+// delete renders the templates like apply does and removes every object they
+// describe, then the named deployments.
+func (p *Plugin) delete(clientset *kubernetes.Clientset) error {
+	objects, err := p.render()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	p.images = objects.Images()
+	p.notify(notifyStarted, nil)
+
+	if len(objects.Data) > 0 {
+		dynamicClient, err := p.createDynamicClient()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		err = objects.Delete(dynamicClient, item.NewRESTMapper(clientset))
+		p.record(objects.Results...)
 		if err != nil {
 			return errors.WithStack(err)
 		}
 	}
 
-	return err
+	for _, name := range p.Config.Deployments {
+		err := item.Delete(name, p.Config.Namespace, p.Config.Propagation, item.NewRetryPolicy(p.Config), clientset)
+		p.recordDeployment(name, item.ActionDeleted, err)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	if p.Config.Wait {
+		for _, name := range p.Config.Deployments {
+			if err := item.WaitDeleted(name, p.Config.Namespace, p.Config.Timeout, clientset); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+	return nil
 }
 
 func (p *Plugin) decodeYamlToObjects(fName string, objects ...interface{}) error {
 	// parse the template file and do substitutions
-	txt, err := openAndSub(fName, p)
+	txt, err := openAndSub(fName, p, nil)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -136,21 +377,144 @@ func (p *Plugin) decodeYamlToObjects(fName string, objects ...interface{}) error
 	return nil
 }
 
-// open up the template and then sub variables in. Handlebar stuff.
-func openAndSub(templateFile string, p *Plugin) (string, error) {
-	t, err := ioutil.ReadFile(templateFile)
+// open up the template, a file or url, and then sub variables in. Handlebar stuff.
+// sops documents are verified first, as templating may change their values.
+func openAndSub(templateFile string, p *Plugin, keys *secret.Keyring) (string, error) {
+	t, err := util.NewFetcher(p.Config).Read(templateFile)
 	if err != nil {
 		return "", err
 	}
+	if err = keys.Verify(t); err != nil {
+		return "", errors.Wrapf(err, "cannot verify %s", templateFile)
+	}
 	//potty humor!  Render trim toilet paper!  Ha ha, so funny.
 	return util.RenderTrim(string(t), p)
 }
 
+// render reads every input, the template files, service, ingress and the
+// kustomization, and returns the objects in the order they are applied in.
+func (p *Plugin) render() (*item.Generic, error) {
+	patterns := p.Config.Template
+	if p.Config.TemplateRepo != "" {
+		dir, cleanup, err := util.CloneTemplates(p.Config)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		patterns = append([]string{dir}, patterns...)
+	}
+	files, err := util.ExpandTemplates(patterns)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range []string{p.Config.Service, p.Config.Ingress} {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+
+	keys, err := p.keyring()
+	if err != nil {
+		return nil, err
+	}
+
+	objects := &item.Generic{Config: p.Config}
+	for _, file := range files {
+		patch, err := openAndSub(file, p, keys)
+		if err != nil {
+			return nil, err
+		}
+		g, err := item.NewGeneric(patch, p.Config)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot decode %s", file)
+		}
+		objects.Data = append(objects.Data, g.Data...)
+	}
+	if p.Config.Kustomize != "" {
+		patch, err := kustomizeAndSub(p.Config.Kustomize, p, keys)
+		if err != nil {
+			return nil, err
+		}
+		g, err := item.NewGeneric(patch, p.Config)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot decode kustomization %s", p.Config.Kustomize)
+		}
+		objects.Data = append(objects.Data, g.Data...)
+	}
+
+	if err = objects.Decrypt(keys); err != nil {
+		return nil, err
+	}
+	objects.Sensitive()
+
+	item.SortByKind(objects.Data)
+	return objects, nil
+}
+
+// build the kustomization and then sub variables in, like openAndSub.
+// kustomize reorders the sops documents, so their macs are checked on the
+// files it reads them from.
+func kustomizeAndSub(dir string, p *Plugin, keys *secret.Keyring) (string, error) {
+	t, err := util.Kustomize(dir)
+	if err != nil {
+		return "", err
+	}
+	sources, err := util.KustomizeSources(dir)
+	if err != nil {
+		return "", err
+	}
+	if err = keys.VerifyBuild(sources, []byte(t)); err != nil {
+		return "", errors.Wrapf(err, "cannot verify kustomization %s", dir)
+	}
+	return util.RenderTrim(t, p)
+}
+
+// parse the decryption key, there is no keyring when none is set.
+func (p Plugin) keyring() (*secret.Keyring, error) {
+	if p.Config.DecryptionKey == "" {
+		return nil, nil
+	}
+	keys, err := secret.ParseKeyring(p.Config.DecryptionKey, p.Config.DecryptionPassphrase)
+	return keys, errors.Wrap(err, "invalid decryption_key")
+}
+
+// create the registry client used to pin images, with the supplied login if any.
+func (p Plugin) createResolver() *registry.Resolver {
+	resolver := registry.NewResolver(p.Config.RegistryInsecure)
+	if p.Config.RegistryUsername != "" {
+		resolver.SetCredential(p.Config.Registry, registry.Credential{
+			Username: p.Config.RegistryUsername,
+			Password: p.Config.RegistryPassword,
+		})
+	}
+	return resolver
+}
+
 // create the connection to kubernetes based on parameters passed in.
 // the kubernetes/client-go project is really hard to understand.
 func (p Plugin) createKubeClient() (*kubernetes.Clientset, error) {
+	cfg, err := p.createKubeConfig()
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(cfg)
+}
+
+// same connection, for objects of kinds without a typed client.
+func (p Plugin) createDynamicClient() (dynamic.Interface, error) {
+	cfg, err := p.createKubeConfig()
+	if err != nil {
+		return nil, err
+	}
+	return dynamic.NewForConfig(cfg)
+}
+
+func (p Plugin) createKubeConfig() (*rest.Config, error) {
 
 	ca, err := base64.StdEncoding.DecodeString(p.Config.Ca)
+	if err != nil {
+		return nil, errors.Wrap(err, "KUBE_CA is not valid base64")
+	}
 	config := clientcmdapi.NewConfig()
 	config.Clusters["drone"] = &clientcmdapi.Cluster{
 		Server:                   p.Config.Server,
@@ -170,8 +534,8 @@ func (p Plugin) createKubeClient() (*kubernetes.Clientset, error) {
 	clientBuilder := clientcmd.NewNonInteractiveClientConfig(*config, "drone", &clientcmd.ConfigOverrides{}, nil)
 	actualCfg, err := clientBuilder.ClientConfig()
 	if err != nil {
-		log.Fatal(err)
+		return nil, errors.WithStack(err)
 	}
 
-	return kubernetes.NewForConfig(actualCfg)
+	return actualCfg, nil
 }
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/goerzh/drone-kube/util"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestExecScaleNeedsReplicas(t *testing.T) {
+	p := &Plugin{Config: util.Config{
+		Server:      "https://10.0.0.1:6443",
+		Token:       "token",
+		Ca:          "ca",
+		Action:      "scale",
+		Deployments: []string{"web"},
+	}}
+	err := p.Exec()
+	if err == nil || !strings.Contains(err.Error(), "replicas") {
+		t.Errorf("expected replicas to be required, got %v", err)
+	}
+}
+
+// The service and ingress urls are read with the template credentials.
+func TestRenderServiceIngressToken(t *testing.T) {
+	var auth []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = append(auth, r.URL.Path+" "+r.Header.Get("Authorization"))
+		kind := map[string]string{"/service.yaml": "Service", "/ingress.yaml": "Ingress"}[r.URL.Path]
+		fmt.Fprintf(w, "apiVersion: v1\nkind: %s\nmetadata:\n  name: web\n", kind)
+	}))
+	defer srv.Close()
+
+	p := &Plugin{Config: util.Config{
+		Namespace:     "shop",
+		Service:       srv.URL + "/service.yaml",
+		Ingress:       srv.URL + "/ingress.yaml",
+		TemplateToken: "t0ken",
+	}}
+	if _, err := p.render(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/service.yaml Bearer t0ken", "/ingress.yaml Bearer t0ken"}
+	if !reflect.DeepEqual(auth, want) {
+		t.Errorf("got %q, want %q", auth, want)
+	}
+}
+
+// kustomizeFixture writes an overlay with a base holding the sops encrypted
+// secret, changed by tamper, and returns the overlay.
+func kustomizeFixture(t *testing.T, tamper func(string) string) string {
+	secretFile, err := ioutil.ReadFile("../secret/testdata/secret.enc.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"base/kustomization.yaml":    "resources:\n- secret.yaml\n",
+		"base/secret.yaml":           tamper(string(secretFile)),
+		"overlay/kustomization.yaml": "namePrefix: prod-\nbases:\n- ../base\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, "overlay")
+}
+
+func TestRenderKustomizeSOPS(t *testing.T) {
+	key, err := ioutil.ReadFile("../secret/testdata/age.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Plugin{Config: util.Config{
+		Namespace:     "shop",
+		Kustomize:     kustomizeFixture(t, func(s string) string { return s }),
+		DecryptionKey: string(key),
+	}}
+	objects, err := p.render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	password, _, _ := unstructured.NestedString(objects.Data[0].Object, "stringData", "password")
+	if password != "s3cr3t-pass" {
+		t.Errorf("password %q", password)
+	}
+
+	p.Config.Kustomize = kustomizeFixture(t, func(s string) string {
+		return strings.Replace(s, "name: db", "name: dc", 1)
+	})
+	if _, err = p.render(); err == nil || !strings.Contains(err.Error(), "mac mismatch") {
+		t.Errorf("expected a mac mismatch for a tampered base, got %v", err)
+	}
+}
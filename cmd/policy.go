@@ -0,0 +1,56 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/goerzh/drone-kube/item"
+	"github.com/goerzh/drone-kube/util"
+	"github.com/pkg/errors"
+)
+
+// policyRules returns the enabled built-in rules followed by the user rules,
+// each named after its file.
+func (p *Plugin) policyRules() ([]item.Rule, error) {
+	var rules []item.Rule
+	for _, name := range p.Config.Policy {
+		rule, err := item.BuiltinRule(name, p.Config.PolicyRegistries)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	files, err := util.ExpandTemplates(p.Config.PolicyRules)
+	if err != nil {
+		return nil, err
+	}
+	fetcher := util.NewFetcher(p.Config)
+	for _, file := range files {
+		text, err := fetcher.Read(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot read policy rule %s", file)
+		}
+		name := filepath.Base(file)
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+		rule, err := item.RegoRule(name, string(text))
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// checkPolicy fails when the objects violate the policy, unless it only warns.
+func (p *Plugin) checkPolicy(objects *item.Generic) error {
+	rules, err := p.policyRules()
+	if err != nil || len(rules) == 0 {
+		return err
+	}
+	violations, err := objects.Check(rules)
+	if err != nil {
+		return err
+	}
+	return item.ReportViolations(violations, p.Config.PolicyWarn)
+}
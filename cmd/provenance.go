@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// provenance describes the build that deploys the objects, for the
+// annotations added with the provenance option.
+func (p *Plugin) provenance(now time.Time) (map[string]string, string) {
+	annotations := map[string]string{
+		"drone-kube/repo":       p.Repo.Owner + "/" + p.Repo.Name,
+		"drone-kube/commit":     p.Build.Commit,
+		"drone-kube/branch":     p.Build.Branch,
+		"drone-kube/tag":        p.Build.Tag,
+		"drone-kube/build":      strconv.Itoa(p.Build.Number),
+		"drone-kube/build-link": p.Build.Link,
+		"drone-kube/deployed":   now.UTC().Format(time.RFC3339),
+	}
+	if p.Repo.Owner == "" && p.Repo.Name == "" {
+		delete(annotations, "drone-kube/repo")
+	}
+	if p.Build.Number == 0 {
+		delete(annotations, "drone-kube/build")
+	}
+
+	commit := p.Build.Commit
+	if len(commit) > 8 {
+		commit = commit[:8]
+	}
+	version := p.Build.Tag
+	if version == "" {
+		version = p.Build.Branch
+	}
+	cause := fmt.Sprintf("drone build #%d of %s/%s: %s %s", p.Build.Number, p.Repo.Owner, p.Repo.Name, version, commit)
+	return annotations, cause
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/goerzh/drone-kube/item"
+	"github.com/goerzh/drone-kube/util"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// Render writes the objects that would be applied as yaml, in the order they
+// would be applied in, with the values of Secrets masked. It needs no
+// cluster credentials. With several
+// clusters, the objects of each are written after a comment naming it.
+func (p *Plugin) Render(w io.Writer) error {
+	if p.Config.Partials != "" {
+		if err := util.LoadPartials(p.Config.Partials); err != nil {
+			return errors.Wrap(err, "cannot load partials")
+		}
+	}
+
+	if len(p.Config.Clusters) == 0 {
+		return p.renderTo(w)
+	}
+	for _, target := range p.Config.Clusters {
+		cp := p.forCluster(target)
+		fmt.Fprintf(w, "# cluster: %s\n", cp.Cluster.Name)
+		if err := cp.renderTo(w); err != nil {
+			return errors.Wrapf(err, "cluster %s", cp.Cluster.Name)
+		}
+	}
+	return nil
+}
+
+func (p *Plugin) renderTo(w io.Writer) error {
+	if err := p.renderNamespace(); err != nil {
+		return err
+	}
+	objects, err := p.render()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// secret values are masked, this output is meant for build logs
+	for i := range objects.Data {
+		out, err := yaml.Marshal(item.Mask(&objects.Data[i]).Object)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		fmt.Fprintf(w, "---\n%s", out)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/goerzh/drone-kube/item"
+	"github.com/goerzh/drone-kube/util"
+	"github.com/pkg/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+type (
+	// report collects what a run did to each object and cluster, for
+	// report_file and the metrics.
+	report struct {
+		mu      sync.Mutex
+		objects []reportObject
+		runs    []clusterRun
+	}
+
+	// clusterRun is the outcome of the action against one cluster.
+	clusterRun struct {
+		cluster   string
+		namespace string
+		started   time.Time
+		duration  time.Duration
+		err       error
+	}
+
+	reportObject struct {
+		Cluster string `json:"cluster,omitempty"`
+		item.Result
+	}
+
+	deployReport struct {
+		Status   string         `json:"status"`
+		Error    string         `json:"error,omitempty"`
+		Action   string         `json:"action"`
+		Started  time.Time      `json:"started"`
+		Finished time.Time      `json:"finished"`
+		Seconds  float64        `json:"seconds"`
+		Build    reportBuild    `json:"build"`
+		Objects  []reportObject `json:"objects"`
+	}
+
+	reportBuild struct {
+		Repo     string `json:"repo,omitempty"`
+		Number   int    `json:"number"`
+		Event    string `json:"event,omitempty"`
+		Commit   string `json:"commit,omitempty"`
+		Ref      string `json:"ref,omitempty"`
+		Branch   string `json:"branch,omitempty"`
+		Tag      string `json:"tag,omitempty"`
+		Author   string `json:"author,omitempty"`
+		Link     string `json:"link,omitempty"`
+		DeployTo string `json:"deploy_to,omitempty"`
+		Stage    string `json:"stage,omitempty"`
+		Step     string `json:"step,omitempty"`
+	}
+)
+
+// past tense of the day-2 actions, for the report
+var operated = map[string]string{
+	"scale":   "scaled",
+	"pause":   "paused",
+	"resume":  "resumed",
+	"restart": "restarted",
+	"status":  "checked",
+}
+
+// deployments returned to their previous revision after a failed smoke test
+const rolledBack = "rolled_back"
+
+// record adds the results of the current cluster to the report, if any.
+func (p *Plugin) record(results ...item.Result) {
+	if p.report == nil {
+		return
+	}
+	p.report.mu.Lock()
+	defer p.report.mu.Unlock()
+	for _, r := range results {
+		p.report.objects = append(p.report.objects, reportObject{Cluster: p.Cluster.Name, Result: r})
+	}
+}
+
+// recordRun records the outcome of the action against the current cluster.
+func (p *Plugin) recordRun(started time.Time, err error) {
+	if p.report == nil {
+		return
+	}
+	p.report.mu.Lock()
+	defer p.report.mu.Unlock()
+	p.report.runs = append(p.report.runs, clusterRun{
+		cluster:   p.Cluster.Name,
+		namespace: p.Config.Namespace,
+		started:   started,
+		duration:  time.Since(started),
+		err:       err,
+	})
+}
+
+// recordDeployment records an action on a deployment named in the settings.
+func (p *Plugin) recordDeployment(name, action string, err error) {
+	r := item.Result{Kind: "Deployment", Namespace: p.Config.Namespace, Name: name, Action: action}
+	if err != nil {
+		r.Action = item.ActionFailed
+		r.Error = err.Error()
+	}
+	p.record(r)
+}
+
+// waitRollout waits for a deployment and adds the outcome to its entry in
+// the report.
+func (p *Plugin) waitRollout(name string, clientset *kubernetes.Clientset) error {
+	started := time.Now()
+	err := item.WaitRollout(name, p.Config.Namespace, p.Config.Timeout, clientset)
+	if p.report == nil {
+		return err
+	}
+
+	rollout := "complete"
+	if err != nil {
+		rollout = "failed: " + err.Error()
+	}
+	p.report.mu.Lock()
+	defer p.report.mu.Unlock()
+	for i := len(p.report.objects) - 1; i >= 0; i-- {
+		o := &p.report.objects[i]
+		if o.Cluster == p.Cluster.Name && o.Kind == "Deployment" && o.Namespace == p.Config.Namespace && o.Name == name {
+			o.Rollout = rollout
+			o.RolloutSeconds = time.Since(started).Seconds()
+			break
+		}
+	}
+	return err
+}
+
+// writeReport writes the report of the run ending with err, masked like
+// any other output.
+func (p *Plugin) writeReport(started time.Time, runErr error) error {
+	finished := time.Now()
+	doc := deployReport{
+		Status:   "success",
+		Action:   p.Config.Action,
+		Started:  started.UTC(),
+		Finished: finished.UTC(),
+		Seconds:  finished.Sub(started).Seconds(),
+		Build: reportBuild{
+			Repo:     p.Repo.Owner + "/" + p.Repo.Name,
+			Number:   p.Build.Number,
+			Event:    p.Build.Event,
+			Commit:   p.Build.Commit,
+			Ref:      p.Build.Ref,
+			Branch:   p.Build.Branch,
+			Tag:      p.Build.Tag,
+			Author:   p.Build.Author,
+			Link:     p.Build.Link,
+			DeployTo: p.Build.DeployTo,
+			Stage:    p.Stage.Name,
+			Step:     p.Step.Name,
+		},
+		Objects: p.report.objects,
+	}
+	if p.Repo.Owner == "" && p.Repo.Name == "" {
+		doc.Build.Repo = ""
+	}
+	if runErr != nil {
+		doc.Status = "failure"
+		doc.Error = runErr.Error()
+	}
+	if doc.Objects == nil {
+		doc.Objects = []reportObject{}
+	}
+
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(ioutil.WriteFile(p.Config.ReportFile, []byte(util.Redact(string(out))+"\n"), 0644))
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/goerzh/drone-kube/item"
+	"github.com/goerzh/drone-kube/util"
+	"github.com/pkg/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+// smoke test urls of these schemes reach a service through the api server
+const (
+	serviceScheme      = "service"
+	serviceHTTPSScheme = "service+https"
+)
+
+// smokeTest requests the smoke test url until it answers as expected, at
+// most SmokeTestRetries more times. The url is rendered with the build
+// variables.
+func (p *Plugin) smokeTest(clientset *kubernetes.Clientset) error {
+	endpoint, err := util.RenderText(p.Config.SmokeTest, p)
+	if err != nil {
+		return errors.Wrap(err, "cannot render smoke test url")
+	}
+	endpoint = strings.TrimSpace(endpoint)
+	var body *regexp.Regexp
+	if p.Config.SmokeTestBody != "" {
+		if body, err = regexp.Compile(p.Config.SmokeTestBody); err != nil {
+			return errors.Wrap(err, "invalid smoke test body pattern")
+		}
+	}
+
+	get, err := p.smokeRequest(endpoint, clientset)
+	if err != nil {
+		return err
+	}
+	log.Println("smoke test " + endpoint)
+	var lastErr error
+	for attempt := 0; attempt <= p.Config.SmokeTestRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(p.Config.SmokeTestInterval)
+		}
+		status, out, err := get()
+		if err == nil {
+			err = p.smokeCheck(status, out, body)
+		}
+		if err == nil {
+			log.Printf("smoke test passed with status %d", status)
+			return nil
+		}
+		lastErr = err
+		log.Printf("smoke test attempt %d: %s", attempt+1, err)
+	}
+	return errors.Errorf("smoke test of %s failed after %d attempts: %s", endpoint, p.Config.SmokeTestRetries+1, lastErr)
+}
+
+// smokeCheck compares a response to the expected status, any 2xx unless
+// set, and body pattern.
+func (p *Plugin) smokeCheck(status int, out []byte, body *regexp.Regexp) error {
+	if expected := p.Config.SmokeTestStatus; expected != 0 && status != expected {
+		return errors.Errorf("status %d, expected %d", status, expected)
+	} else if expected == 0 && (status < 200 || status >= 300) {
+		return errors.Errorf("status %d", status)
+	}
+	if body != nil && !body.Match(out) {
+		return errors.Errorf("body does not match %s", body)
+	}
+	return nil
+}
+
+// smokeRequest returns a function sending the request, either straight to
+// the url or, for service:// urls, through the service proxy of the api
+// server, e.g. service://web.shop:8080/healthz for port 8080 of the
+// service web in the namespace shop, the deploy namespace by default.
+func (p *Plugin) smokeRequest(endpoint string, clientset *kubernetes.Clientset) (func() (int, []byte, error), error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid smoke test url")
+	}
+
+	if u.Scheme != serviceScheme && u.Scheme != serviceHTTPSScheme {
+		client := &http.Client{Timeout: 10 * time.Second}
+		return func() (int, []byte, error) {
+			res, err := client.Get(endpoint)
+			if err != nil {
+				return 0, nil, errors.WithStack(err)
+			}
+			defer res.Body.Close()
+			out, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				return 0, nil, errors.WithStack(err)
+			}
+			return res.StatusCode, out, nil
+		}, nil
+	}
+
+	name, namespace := u.Hostname(), p.Config.Namespace
+	if i := strings.Index(name, "."); i >= 0 {
+		name, namespace = name[:i], name[i+1:]
+	}
+	// the proxy addresses a service as [scheme:]name[:port]
+	target := name
+	if u.Scheme == serviceHTTPSScheme {
+		target = "https:" + name + ":" + u.Port()
+	} else if u.Port() != "" {
+		target = name + ":" + u.Port()
+	}
+	return func() (int, []byte, error) {
+		req := clientset.CoreV1().RESTClient().Get().
+			Namespace(namespace).
+			Resource("services").
+			Name(target).
+			SubResource("proxy").
+			Suffix(u.Path).
+			Timeout(10 * time.Second)
+		for key, values := range u.Query() {
+			for _, v := range values {
+				req.Param(key, v)
+			}
+		}
+		var status int
+		out, err := req.Do().StatusCode(&status).Raw()
+		if status == 0 && err != nil {
+			return 0, nil, errors.WithStack(err)
+		}
+		return status, out, nil
+	}, nil
+}
+
+// deploymentRevision is the revision a deployment had before the run.
+type deploymentRevision struct {
+	Namespace string
+	Name      string
+	Revision  int64
+}
+
+// revisions records the revision of the deployments of the templates and
+// the restarted ones before they are applied, so a rollback only touches
+// those this run rolled out.
+func (p *Plugin) revisions(objects *item.Generic, clientset *kubernetes.Clientset) []deploymentRevision {
+	var deployments []deploymentRevision
+	seen := map[string]bool{}
+	add := func(namespace, name string) {
+		if seen[namespace+"/"+name] {
+			return
+		}
+		seen[namespace+"/"+name] = true
+		revision, err := item.Revision(name, namespace, clientset)
+		if err != nil {
+			log.Printf("cannot get the revision of deployment %s: %s", name, err)
+			return
+		}
+		// a new deployment has nothing to go back to
+		if revision > 0 {
+			deployments = append(deployments, deploymentRevision{Namespace: namespace, Name: name, Revision: revision})
+		}
+	}
+	for _, obj := range objects.Data {
+		if obj.GetKind() != "Deployment" {
+			continue
+		}
+		namespace := obj.GetNamespace()
+		if namespace == "" {
+			namespace = p.Config.Namespace
+		}
+		add(namespace, obj.GetName())
+	}
+	for _, name := range p.Config.Restart {
+		add(p.Config.Namespace, name)
+	}
+	return deployments
+}
+
+// rollback returns the deployments whose revision went up since it was
+// recorded to their previous revision, after a failed smoke test.
+func (p *Plugin) rollback(deployments []deploymentRevision, clientset *kubernetes.Clientset) error {
+	var failed []string
+	for _, d := range deployments {
+		revision, err := item.Revision(d.Name, d.Namespace, clientset)
+		if err == nil && revision <= d.Revision {
+			log.Printf("deployment %s was not rolled out by this run, leave it at revision %d", d.Name, revision)
+			continue
+		}
+		if err == nil {
+			err = item.Rollback(d.Name, d.Namespace, item.NewRetryPolicy(p.Config), clientset)
+		}
+		r := item.Result{Kind: "Deployment", Namespace: d.Namespace, Name: d.Name, Action: rolledBack}
+		if err != nil {
+			r.Action = item.ActionFailed
+			r.Error = err.Error()
+		}
+		p.record(r)
+		if err == nil && p.Config.Wait && d.Namespace == p.Config.Namespace {
+			err = p.waitRollout(d.Name, clientset)
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", d.Name, err))
+		}
+	}
+	if len(failed) > 0 {
+		return errors.Errorf("cannot roll back %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/goerzh/drone-kube/util"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	testDeployment = `{"kind":"Deployment","apiVersion":"apps/v1beta1","metadata":{"name":"web","namespace":"shop","uid":"d-1","annotations":{"deployment.kubernetes.io/revision":"3"}},"spec":{"selector":{"matchLabels":{"app":"web"}},"template":{"metadata":{"labels":{"app":"web"}},"spec":{"containers":[{"name":"web","image":"app:3"}]}}}}`
+	testReplicaSet = `{"metadata":{"name":"web-%[1]d","annotations":{"deployment.kubernetes.io/revision":"%[1]d"},"ownerReferences":[{"apiVersion":"apps/v1","kind":"Deployment","name":"web","uid":"d-1","controller":true}]},"spec":{"selector":{"matchLabels":{"app":"web"}},"template":{"metadata":{"labels":{"app":"web"}},"spec":{"containers":[{"name":"web","image":"app:%[1]d"}]}}}}`
+)
+
+// rollbackServer serves the deployment web at revision 3 and its replica
+// sets, and fails the first patch with a conflict.
+func rollbackServer(t *testing.T) (*kubernetes.Clientset, *int) {
+	patches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/apis/apps/v1beta1/namespaces/shop/deployments/web":
+			fmt.Fprint(w, testDeployment)
+		case r.Method == http.MethodGet && r.URL.Path == "/apis/apps/v1/namespaces/shop/replicasets":
+			fmt.Fprintf(w, `{"kind":"ReplicaSetList","apiVersion":"apps/v1","items":[`+testReplicaSet+`,`+testReplicaSet+`]}`, 2, 3)
+		case r.Method == http.MethodPatch && r.URL.Path == "/apis/apps/v1beta1/namespaces/shop/deployments/web":
+			if patches++; patches == 1 {
+				w.WriteHeader(http.StatusConflict)
+				fmt.Fprint(w, `{"kind":"Status","apiVersion":"v1","status":"Failure","message":"the object has been modified","reason":"Conflict","code":409}`)
+				return
+			}
+			fmt.Fprint(w, testDeployment)
+		default:
+			t.Errorf("unexpected %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, &patches
+}
+
+func TestRollbackRetriedAfterLongWait(t *testing.T) {
+	client, patches := rollbackServer(t)
+	p := &Plugin{
+		Config: util.Config{Namespace: "shop", RetryAttempts: 3, RetryDeadline: time.Second},
+		report: &report{},
+	}
+
+	// the smoke test took longer than the retry deadline, which must not
+	// keep the rollback from being retried
+	time.Sleep(1200 * time.Millisecond)
+	err := p.rollback([]deploymentRevision{{Namespace: "shop", Name: "web", Revision: 2}}, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *patches != 2 {
+		t.Errorf("got %d patches, want 2", *patches)
+	}
+	if len(p.report.objects) != 1 || p.report.objects[0].Action != rolledBack {
+		t.Errorf("got %+v, want web rolled back", p.report.objects)
+	}
+}
+
+func TestRollbackSkipsUnchanged(t *testing.T) {
+	client, patches := rollbackServer(t)
+	p := &Plugin{Config: util.Config{Namespace: "shop"}, report: &report{}}
+
+	if err := p.rollback([]deploymentRevision{{Namespace: "shop", Name: "web", Revision: 3}}, client); err != nil {
+		t.Fatal(err)
+	}
+	if *patches != 0 || len(p.report.objects) != 0 {
+		t.Errorf("expected web to be left alone, got %d patches and %+v", *patches, p.report.objects)
+	}
+}
@@ -0,0 +1,64 @@
+package item
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// reasons of the events recorded on applied objects
+const (
+	EventDeployed     = "DroneDeploy"
+	EventDeployFailed = "DroneDeployFailed"
+)
+
+// RecordEvent records a kubernetes event about the object of a result, next
+// to the events of its pods. Events of objects that are not namespaced go to
+// the default namespace.
+func RecordEvent(result Result, message string, retry RetryPolicy, client *kubernetes.Clientset) error {
+	reason, kind := EventDeployed, coreV1.EventTypeNormal
+	if result.Action == ActionFailed {
+		reason, kind = EventDeployFailed, coreV1.EventTypeWarning
+	}
+	namespace := result.Namespace
+	if namespace == "" {
+		namespace = metaV1.NamespaceDefault
+	}
+
+	now := metaV1.NewTime(time.Now())
+	event := &coreV1.Event{
+		ObjectMeta: metaV1.ObjectMeta{
+			// the same naming as the events of kubectl and the controllers
+			Name:      fmt.Sprintf("%s.%x", result.Name, now.UnixNano()),
+			Namespace: namespace,
+		},
+		InvolvedObject: coreV1.ObjectReference{
+			APIVersion:      result.APIVersion,
+			Kind:            result.Kind,
+			Namespace:       result.Namespace,
+			Name:            result.Name,
+			UID:             result.UID,
+			ResourceVersion: result.NewResourceVersion,
+		},
+		Reason:              reason,
+		Message:             message,
+		Type:                kind,
+		Source:              coreV1.EventSource{Component: "drone-kube"},
+		FirstTimestamp:      now,
+		LastTimestamp:       now,
+		Count:               1,
+		ReportingController: "drone-kube",
+	}
+	err := retry.Do(func() error {
+		_, err := client.CoreV1().Events(namespace).Create(event)
+		return err
+	})
+	if err != nil {
+		return errors.Wrapf(err, "cannot record event for %s %s", result.Kind, result.Name)
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+package item
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/goerzh/drone-kube/util"
+	"github.com/pkg/errors"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery/cached"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
+)
+
+// Generic holds objects of any kind, handled through the dynamic client.
+type Generic struct {
+	Data   []unstructured.Unstructured
+	Patch  string
+	Config util.Config
+
+	// what Apply or Delete did to each object, in order
+	Results []Result
+}
+
+func NewGeneric(patch string, cfg util.Config) (*Generic, error) {
+	g := &Generic{
+		Patch:  patch,
+		Config: cfg,
+	}
+	dc := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader([]byte(g.Patch)), 4096)
+	for {
+		ext := runtime.RawExtension{}
+		if err := dc.Decode(&ext); err != nil {
+			if err == io.EOF {
+				return g, nil
+			}
+			return nil, errors.WithStack(err)
+		}
+		if len(bytes.TrimSpace(ext.Raw)) == 0 || string(ext.Raw) == "null" {
+			continue
+		}
+		obj := unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(ext.Raw); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		g.Data = append(g.Data, obj)
+	}
+}
+
+// NewRESTMapper discovers the resources served by the cluster, so objects of
+// any kind can be mapped to their api endpoint.
+func NewRESTMapper(client *kubernetes.Clientset) meta.RESTMapper {
+	return restmapper.NewDeferredDiscoveryRESTMapper(cached.NewMemCacheClient(client.Discovery()))
+}
+
+// Apply creates every object that does not exist yet and updates the others,
+// recording what happened to each in Results.
+func (g *Generic) Apply(client dynamic.Interface, mapper meta.RESTMapper) error {
+	for i := range g.Data {
+		obj := &g.Data[i]
+		var result Result
+		started := time.Now()
+		err := NewRetryPolicy(g.Config).Do(func() error {
+			result = newResult(obj, g.namespace(obj))
+			return g.apply(obj, client, mapper, &result)
+		})
+		result.ApplySeconds = time.Since(started).Seconds()
+		if err != nil {
+			result.Action = ActionFailed
+			result.Error = err.Error()
+		}
+		g.Results = append(g.Results, result)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *Generic) apply(obj *unstructured.Unstructured, client dynamic.Interface, mapper meta.RESTMapper, result *Result) error {
+	res, err := g.resourceFor(obj, client, mapper)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	origin, err := res.Get(obj.GetName(), metaV1.GetOptions{})
+	if kubeerrors.IsNotFound(err) {
+		created, err := res.Create(obj, metaV1.CreateOptions{})
+		if kubeerrors.IsAlreadyExists(err) {
+			// created since the get, trying again updates it
+			gvk := obj.GroupVersionKind()
+			return errors.WithStack(kubeerrors.NewConflict(schema.GroupResource{Group: gvk.Group, Resource: strings.ToLower(gvk.Kind)}, obj.GetName(), err))
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		log.Println("create " + describe(obj))
+		result.Action = ActionCreated
+		result.live(created)
+		return nil
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	result.OldResourceVersion = origin.GetResourceVersion()
+	result.OldImages = images(origin)
+
+	obj.SetResourceVersion(origin.GetResourceVersion())
+	if obj.GetKind() == "Service" {
+		// the cluster ip is immutable and allocated by the api server
+		ip, _, _ := unstructured.NestedString(origin.Object, "spec", "clusterIP")
+		if _, found, _ := unstructured.NestedString(obj.Object, "spec", "clusterIP"); !found && ip != "" {
+			unstructured.SetNestedField(obj.Object, ip, "spec", "clusterIP")
+		}
+	}
+	updated, err := res.Update(obj, metaV1.UpdateOptions{})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	result.live(updated)
+	// the api server keeps the resource version of an update changing nothing
+	if result.NewResourceVersion == result.OldResourceVersion {
+		log.Println(describe(obj) + " unchanged")
+		result.Action = ActionUnchanged
+		return nil
+	}
+	log.Println("update " + describe(obj))
+	result.Action = ActionUpdated
+	return nil
+}
+
+// Delete removes every object, in reverse order, skipping those that are
+// already gone. With Config.Wait it returns once they have disappeared.
+func (g *Generic) Delete(client dynamic.Interface, mapper meta.RESTMapper) error {
+	propagation := PropagationPolicy(g.Config.Propagation)
+	for i := len(g.Data) - 1; i >= 0; i-- {
+		obj := &g.Data[i]
+		result := newResult(obj, g.namespace(obj))
+		res, err := g.resourceFor(obj, client, mapper)
+		if err == nil {
+			err = NewRetryPolicy(g.Config).Do(func() error {
+				return res.Delete(obj.GetName(), &metaV1.DeleteOptions{PropagationPolicy: &propagation})
+			})
+		}
+		switch {
+		case kubeerrors.IsNotFound(err):
+			log.Println(describe(obj) + " already absent")
+			result.Action = ActionAbsent
+		case meta.IsNoMatchError(errors.Cause(err)):
+			// its definition is gone, and every object of the kind with it
+			log.Println(describe(obj) + " already absent, its kind is no longer served")
+			result.Action = ActionAbsent
+		case err != nil:
+			result.Action = ActionFailed
+			result.Error = err.Error()
+		default:
+			log.Println("delete " + describe(obj))
+			result.Action = ActionDeleted
+		}
+		g.Results = append(g.Results, result)
+		if result.Action == ActionFailed {
+			return errors.WithStack(err)
+		}
+	}
+
+	if !g.Config.Wait {
+		return nil
+	}
+	for i := range g.Data {
+		obj := &g.Data[i]
+		res, err := g.resourceFor(obj, client, mapper)
+		if meta.IsNoMatchError(errors.Cause(err)) {
+			continue
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		err = wait.PollImmediate(2*time.Second, g.Config.Timeout, func() (bool, error) {
+			_, err := res.Get(obj.GetName(), metaV1.GetOptions{})
+			if kubeerrors.IsNotFound(err) {
+				return true, nil
+			}
+			return false, err
+		})
+		if err == wait.ErrWaitTimeout {
+			return errors.Errorf("%s still exists after %s", describe(obj), g.Config.Timeout)
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// PropagationPolicy parses the propagation setting, background by default.
+func PropagationPolicy(s string) metaV1.DeletionPropagation {
+	switch strings.ToLower(s) {
+	case "foreground":
+		return metaV1.DeletePropagationForeground
+	case "orphan":
+		return metaV1.DeletePropagationOrphan
+	}
+	return metaV1.DeletePropagationBackground
+}
+
+// resourceFor returns the dynamic client endpoint of an object, in its own
+// namespace or the configured one.
+func (g *Generic) resourceFor(obj *unstructured.Unstructured, client dynamic.Interface, mapper meta.RESTMapper) (dynamic.ResourceInterface, error) {
+	gvk := obj.GroupVersionKind()
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		// the kind may come from a definition applied moments ago
+		if resettable, ok := mapper.(*restmapper.DeferredDiscoveryRESTMapper); ok {
+			resettable.Reset()
+			mapping, err = mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		}
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot map %s", describe(obj))
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return client.Resource(mapping.Resource), nil
+	}
+	return client.Resource(mapping.Resource).Namespace(g.namespace(obj)), nil
+}
+
+// namespace returns the namespace of an object, or the configured one.
+func (g *Generic) namespace(obj *unstructured.Unstructured) string {
+	if ns := obj.GetNamespace(); ns != "" {
+		return ns
+	}
+	return g.Config.Namespace
+}
+
+// describe names an object for log lines, e.g. `deployment fk-model-deploy`.
+func describe(obj *unstructured.Unstructured) string {
+	return strings.ToLower(obj.GetKind()) + " " + obj.GetName()
+}
@@ -0,0 +1,107 @@
+package item
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/goerzh/drone-kube/util"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+const deleteTemplates = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: web
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+`
+
+// deleteServer has the ConfigMap web but no Service, and logs every request
+// as `METHOD path body`.
+func deleteServer(t *testing.T) (dynamic.Interface, *[]string) {
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, strings.TrimSpace(r.Method+" "+r.URL.Path+" "+string(body)))
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(r.URL.Path, "/services/") || r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`)
+			return
+		}
+		fmt.Fprint(w, `{"kind":"Status","apiVersion":"v1","status":"Success"}`)
+	}))
+	t.Cleanup(srv.Close)
+	client, err := dynamic.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, &requests
+}
+
+// testMapper knows ConfigMaps and Services, not the Widgets of a deleted
+// custom resource definition.
+func testMapper() meta.RESTMapper {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	v1 := schema.GroupVersion{Version: "v1"}
+	mapper.Add(v1.WithKind("ConfigMap"), meta.RESTScopeNamespace)
+	mapper.Add(v1.WithKind("Service"), meta.RESTScopeNamespace)
+	return mapper
+}
+
+func TestDelete(t *testing.T) {
+	client, requests := deleteServer(t)
+	g, err := NewGeneric(deleteTemplates, util.Config{Namespace: "shop", Propagation: "foreground", Wait: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = g.Delete(client, testMapper()); err != nil {
+		t.Fatal(err)
+	}
+
+	// in reverse order, then waiting for each to be gone
+	options := `{"kind":"DeleteOptions","apiVersion":"v1","propagationPolicy":"Foreground"}`
+	want := []string{
+		"DELETE /api/v1/namespaces/shop/services/web " + options,
+		"DELETE /api/v1/namespaces/shop/configmaps/web " + options,
+		"GET /api/v1/namespaces/shop/configmaps/web",
+		"GET /api/v1/namespaces/shop/services/web",
+	}
+	if !reflect.DeepEqual(*requests, want) {
+		t.Errorf("got %q, want %q", *requests, want)
+	}
+
+	var actions []string
+	for _, r := range g.Results {
+		actions = append(actions, r.Kind+" "+r.Action)
+	}
+	if want := []string{"Service absent", "Widget absent", "ConfigMap deleted"}; !reflect.DeepEqual(actions, want) {
+		t.Errorf("got %q, want %q", actions, want)
+	}
+}
+
+func TestPropagationPolicy(t *testing.T) {
+	tests := map[string]string{"": "Background", "background": "Background", "Foreground": "Foreground", "orphan": "Orphan"}
+	for in, want := range tests {
+		if got := string(PropagationPolicy(in)); got != want {
+			t.Errorf("%q: got %s, want %s", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package item
+
+import (
+	"log"
+
+	"github.com/goerzh/drone-kube/util"
+	"github.com/pkg/errors"
+	coreV1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	DefaultQuotaName = "default-quota"
+	DefaultLimitName = "default-limits"
+)
+
+// EnsureNamespace creates the configured namespace if it does not exist yet,
+// along with its default ResourceQuota and LimitRange. Existing namespaces
+// are left untouched.
+func EnsureNamespace(cfg util.Config, client *kubernetes.Clientset) error {
+	_, err := client.CoreV1().Namespaces().Get(cfg.Namespace, metaV1.GetOptions{})
+	if err == nil {
+		return nil
+	}
+	if !kubeerrors.IsNotFound(err) {
+		return errors.WithStack(err)
+	}
+
+	retry := NewRetryPolicy(cfg)
+
+	// a typo in a quantity must not leave a namespace without its quota
+	hard, err := resourceList(cfg.NamespaceQuota)
+	if err != nil {
+		return errors.Wrap(err, "invalid namespace quota")
+	}
+	limits, err := resourceList(cfg.NamespaceLimits)
+	if err != nil {
+		return errors.Wrap(err, "invalid namespace limits")
+	}
+	requests, err := resourceList(cfg.NamespaceRequests)
+	if err != nil {
+		return errors.Wrap(err, "invalid namespace requests")
+	}
+
+	ns := &coreV1.Namespace{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:        cfg.Namespace,
+			Labels:      cfg.NamespaceLabels,
+			Annotations: cfg.NamespaceAnnotations,
+		},
+	}
+	// a create that timed out may still have gone through, so the retry
+	// finds it already there
+	if err = retry.Do(func() error {
+		_, err := client.CoreV1().Namespaces().Create(ns)
+		return err
+	}); err != nil && !kubeerrors.IsAlreadyExists(err) {
+		return errors.WithStack(err)
+	}
+	log.Println("create namespace " + cfg.Namespace)
+
+	if len(hard) > 0 {
+		quota := &coreV1.ResourceQuota{
+			ObjectMeta: metaV1.ObjectMeta{Name: DefaultQuotaName},
+			Spec:       coreV1.ResourceQuotaSpec{Hard: hard},
+		}
+		if err = retry.Do(func() error {
+			_, err := client.CoreV1().ResourceQuotas(cfg.Namespace).Create(quota)
+			return err
+		}); err != nil && !kubeerrors.IsAlreadyExists(err) {
+			return errors.WithStack(err)
+		}
+		log.Println("create resourcequota " + DefaultQuotaName)
+	}
+
+	if len(limits) > 0 || len(requests) > 0 {
+		limitRange := &coreV1.LimitRange{
+			ObjectMeta: metaV1.ObjectMeta{Name: DefaultLimitName},
+			Spec: coreV1.LimitRangeSpec{
+				Limits: []coreV1.LimitRangeItem{{
+					Type:           coreV1.LimitTypeContainer,
+					Default:        limits,
+					DefaultRequest: requests,
+				}},
+			},
+		}
+		if err = retry.Do(func() error {
+			_, err := client.CoreV1().LimitRanges(cfg.Namespace).Create(limitRange)
+			return err
+		}); err != nil && !kubeerrors.IsAlreadyExists(err) {
+			return errors.WithStack(err)
+		}
+		log.Println("create limitrange " + DefaultLimitName)
+	}
+
+	return nil
+}
+
+func resourceList(values map[string]string) (coreV1.ResourceList, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	list := coreV1.ResourceList{}
+	for name, value := range values {
+		q, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s=%s", name, value)
+		}
+		list[coreV1.ResourceName(name)] = q
+	}
+	return list, nil
+}
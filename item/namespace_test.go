@@ -0,0 +1,65 @@
+package item
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/goerzh/drone-kube/util"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestEnsureNamespaceInvalidQuantities(t *testing.T) {
+	tests := []util.Config{
+		{Namespace: "shop", NamespaceQuota: map[string]string{"pods": "ten"}},
+		{Namespace: "shop", NamespaceLimits: map[string]string{"memory": "1Gi"}, NamespaceRequests: map[string]string{"cpu": "0.1.2"}},
+	}
+	for _, cfg := range tests {
+		client := fakeAPIServer(t, func(r *http.Request) {
+			if r.Method != http.MethodGet {
+				t.Errorf("nothing should be created, got %s %s", r.Method, r.URL.Path)
+			}
+		})
+		if err := EnsureNamespace(cfg, client); err == nil {
+			t.Errorf("%+v: expected an error", cfg)
+		}
+	}
+}
+
+func TestEnsureNamespaceAlreadyCreated(t *testing.T) {
+	var created []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`)
+		case http.MethodPost:
+			created = append(created, r.URL.Path)
+			// an earlier attempt that timed out went through after all
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprint(w, `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"AlreadyExists","code":409}`)
+		}
+	}))
+	defer srv.Close()
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := util.Config{
+		Namespace:       "shop",
+		NamespaceQuota:  map[string]string{"pods": "10"},
+		NamespaceLimits: map[string]string{"memory": "1Gi"},
+	}
+	if err = EnsureNamespace(cfg, client); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/api/v1/namespaces", "/api/v1/namespaces/shop/resourcequotas", "/api/v1/namespaces/shop/limitranges"}
+	if !reflect.DeepEqual(created, want) {
+		t.Errorf("got %v, want %v", created, want)
+	}
+}
@@ -0,0 +1,54 @@
+package item
+
+import (
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// applyOrder ranks kinds so that everything an object depends on is applied
+// before it: namespaces and definitions, then identities and permissions,
+// config and storage, workloads and finally the way they are exposed.
+// Kinds not listed, like custom resources, come last.
+var applyOrder = map[string]int{
+	"Namespace":                0,
+	"CustomResourceDefinition": 1,
+	"ServiceAccount":           2,
+	"ClusterRole":              3,
+	"Role":                     3,
+	"ClusterRoleBinding":       4,
+	"RoleBinding":              4,
+	"ResourceQuota":            5,
+	"LimitRange":               5,
+	"ConfigMap":                6,
+	"Secret":                   6,
+	"PersistentVolume":         7,
+	"PersistentVolumeClaim":    7,
+	"Pod":                      8,
+	"ReplicaSet":               8,
+	"ReplicationController":    8,
+	"Deployment":               8,
+	"StatefulSet":              8,
+	"DaemonSet":                8,
+	"Job":                      8,
+	"CronJob":                  8,
+	"HorizontalPodAutoscaler":  9,
+	"PodDisruptionBudget":      9,
+	"Service":                  10,
+	"Ingress":                  11,
+}
+
+func kindRank(kind string) int {
+	if rank, ok := applyOrder[kind]; ok {
+		return rank
+	}
+	return len(applyOrder)
+}
+
+// SortByKind orders objects for applying. Objects of the same rank keep the
+// order they were read in, so the result is deterministic.
+func SortByKind(objects []unstructured.Unstructured) {
+	sort.SliceStable(objects, func(i, j int) bool {
+		return kindRank(objects[i].GetKind()) < kindRank(objects[j].GetKind())
+	})
+}
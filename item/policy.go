@@ -0,0 +1,234 @@
+package item
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/goerzh/drone-kube/registry"
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/pkg/errors"
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Rule checks a single object and returns a message for every violation.
+type Rule struct {
+	Name  string
+	Check func(obj *unstructured.Unstructured) ([]string, error)
+}
+
+// Violation is a rule an object does not satisfy.
+type Violation struct {
+	Object  string
+	Rule    string
+	Message string
+}
+
+// BuiltinRules are the rules that can be enabled by name.
+var BuiltinRules = []string{"no-latest", "no-privileged", "resource-limits", "run-as-non-root", "allowed-registries"}
+
+// BuiltinRule returns the built-in rule of that name. allowed-registries
+// takes the image prefixes to allow.
+func BuiltinRule(name string, registries []string) (Rule, error) {
+	switch name {
+	case "no-latest":
+		return containerRule(name, noLatest), nil
+	case "no-privileged":
+		return containerRule(name, noPrivileged), nil
+	case "resource-limits":
+		return containerRule(name, resourceLimits), nil
+	case "run-as-non-root":
+		return containerRule(name, runAsNonRoot), nil
+	case "allowed-registries":
+		if len(registries) == 0 {
+			return Rule{}, errors.New("allowed-registries needs policy.registries")
+		}
+		return containerRule(name, func(_ *coreV1.PodSpec, c *coreV1.Container) string {
+			return allowedRegistry(c.Image, registries)
+		}), nil
+	}
+	return Rule{}, errors.Errorf("unknown policy rule %q, expected one of %s", name, strings.Join(BuiltinRules, ", "))
+}
+
+// RegoRule is a user rule written in Rego. It is evaluated for every object
+// with the object as input, and every message of its deny set is a
+// violation.
+func RegoRule(name, module string) (Rule, error) {
+	file := name + ".rego"
+	parsed, err := ast.ParseModule(file, module)
+	if err != nil {
+		return Rule{}, errors.Wrapf(err, "policy rule %s", name)
+	}
+	if parsed == nil {
+		return Rule{}, errors.Errorf("policy rule %s is empty", name)
+	}
+	hasDeny := false
+	for _, r := range parsed.Rules {
+		hasDeny = hasDeny || r.Head.Name.Equal(ast.Var("deny"))
+	}
+	if !hasDeny {
+		return Rule{}, errors.Errorf("policy rule %s has no deny rule", name)
+	}
+	compiler, err := ast.CompileModules(map[string]string{file: module})
+	if err != nil {
+		return Rule{}, errors.Wrapf(err, "policy rule %s", name)
+	}
+	query := parsed.Package.Path.String() + ".deny"
+
+	return Rule{Name: name, Check: func(obj *unstructured.Unstructured) ([]string, error) {
+		rs, err := rego.New(rego.Query(query), rego.Compiler(compiler), rego.Input(obj.Object)).Eval(context.Background())
+		if err != nil {
+			return nil, errors.Wrapf(err, "policy rule %s", name)
+		}
+		var messages []string
+		for _, r := range rs {
+			for _, expr := range r.Expressions {
+				values, ok := expr.Value.([]interface{})
+				if !ok {
+					return nil, errors.Errorf("policy rule %s: deny must be a set of messages", name)
+				}
+				for _, v := range values {
+					if msg, ok := v.(string); ok {
+						messages = append(messages, msg)
+					} else {
+						messages = append(messages, fmt.Sprint(v))
+					}
+				}
+			}
+		}
+		sort.Strings(messages)
+		return messages, nil
+	}}, nil
+}
+
+// Check evaluates every object against the rules and returns the violations,
+// in the order of the objects.
+func (g *Generic) Check(rules []Rule) ([]Violation, error) {
+	var violations []Violation
+	for i := range g.Data {
+		obj := &g.Data[i]
+		for _, rule := range rules {
+			messages, err := rule.Check(obj)
+			if err != nil {
+				return nil, err
+			}
+			for _, msg := range messages {
+				violations = append(violations, Violation{Object: describe(obj), Rule: rule.Name, Message: msg})
+			}
+		}
+	}
+	return violations, nil
+}
+
+// ReportViolations logs the violations grouped per object and returns an
+// error when there are any, unless warn is set.
+func ReportViolations(violations []Violation, warn bool) error {
+	if len(violations) == 0 {
+		return nil
+	}
+	objects := 0
+	for i, v := range violations {
+		if i == 0 || violations[i-1].Object != v.Object {
+			log.Println("policy violations in " + v.Object + ":")
+			objects++
+		}
+		log.Printf("  [%s] %s", v.Rule, v.Message)
+	}
+	if warn {
+		log.Printf("%d policy violations in %d objects, continuing as policy.warn is set", len(violations), objects)
+		return nil
+	}
+	return errors.Errorf("%d policy violations in %d objects", len(violations), objects)
+}
+
+// containerRule applies check to every container and init container of a
+// workload or pod.
+func containerRule(name string, check func(spec *coreV1.PodSpec, c *coreV1.Container) string) Rule {
+	return Rule{Name: name, Check: func(obj *unstructured.Unstructured) ([]string, error) {
+		spec, _, err := podSpec(obj)
+		if err != nil || spec == nil {
+			return nil, err
+		}
+		var messages []string
+		for _, containers := range [][]coreV1.Container{spec.InitContainers, spec.Containers} {
+			for i := range containers {
+				if msg := check(spec, &containers[i]); msg != "" {
+					messages = append(messages, fmt.Sprintf("container %s: %s", containers[i].Name, msg))
+				}
+			}
+		}
+		return messages, nil
+	}}
+}
+
+func noLatest(_ *coreV1.PodSpec, c *coreV1.Container) string {
+	ref, err := registry.ParseReference(c.Image)
+	if err != nil {
+		return err.Error()
+	}
+	if ref.Digest == "" && ref.Tag == "latest" {
+		return "image " + c.Image + " uses the latest tag"
+	}
+	return ""
+}
+
+func noPrivileged(_ *coreV1.PodSpec, c *coreV1.Container) string {
+	if c.SecurityContext != nil && c.SecurityContext.Privileged != nil && *c.SecurityContext.Privileged {
+		return "runs privileged"
+	}
+	return ""
+}
+
+func resourceLimits(_ *coreV1.PodSpec, c *coreV1.Container) string {
+	var missing []string
+	for _, name := range []coreV1.ResourceName{coreV1.ResourceCPU, coreV1.ResourceMemory} {
+		if _, ok := c.Resources.Limits[name]; !ok {
+			missing = append(missing, string(name))
+		}
+	}
+	if len(missing) > 0 {
+		return "has no " + strings.Join(missing, " and ") + " limit"
+	}
+	return ""
+}
+
+// a container runs as non root when it says so, or inherits it from the pod
+func runAsNonRoot(spec *coreV1.PodSpec, c *coreV1.Container) string {
+	nonRoot := spec.SecurityContext != nil && spec.SecurityContext.RunAsNonRoot != nil && *spec.SecurityContext.RunAsNonRoot
+	if c.SecurityContext != nil && c.SecurityContext.RunAsNonRoot != nil {
+		nonRoot = *c.SecurityContext.RunAsNonRoot
+	}
+	if !nonRoot {
+		return "does not set runAsNonRoot"
+	}
+	return ""
+}
+
+// the image may be written with or without the implicit docker.io/library/
+func allowedRegistry(image string, registries []string) string {
+	names := []string{image}
+	if ref, err := registry.ParseReference(image); err == nil {
+		names = append(names, ref.Domain+"/"+ref.Path)
+	}
+	for _, prefix := range registries {
+		for _, name := range names {
+			if hasPathPrefix(name, prefix) {
+				return ""
+			}
+		}
+	}
+	return "image " + image + " is not from an allowed registry"
+}
+
+// hasPathPrefix tells whether prefix matches name up to a / boundary, so
+// registry.io does not allow registry.io.evil.com/app.
+func hasPathPrefix(name, prefix string) bool {
+	if !strings.HasPrefix(name, prefix) {
+		return false
+	}
+	return len(name) == len(prefix) || strings.HasSuffix(prefix, "/") || name[len(prefix)] == '/'
+}
@@ -0,0 +1,196 @@
+package item
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/goerzh/drone-kube/util"
+)
+
+func TestAllowedRegistry(t *testing.T) {
+	tests := []struct {
+		image      string
+		registries []string
+		allowed    bool
+	}{
+		{"ccr.ccs.tencentyun.com/team/app:v1", []string{"ccr.ccs.tencentyun.com"}, true},
+		{"ccr.ccs.tencentyun.com/team/app:v1", []string{"ccr.ccs.tencentyun.com/"}, true},
+		{"ccr.ccs.tencentyun.com/team/app:v1", []string{"ccr.ccs.tencentyun.com/team"}, true},
+		{"ccr.ccs.tencentyun.com/team/app:v1", []string{"ccr.ccs.tencentyun.com/team/app"}, true},
+		{"ccr.ccs.tencentyun.com.evil.io/x", []string{"ccr.ccs.tencentyun.com"}, false},
+		{"ccr.ccs.tencentyun.com/teams/app", []string{"ccr.ccs.tencentyun.com/team"}, false},
+		{"ccr.ccs.tencentyun.com/team/app-evil", []string{"ccr.ccs.tencentyun.com/team/app"}, false},
+		{"nginx", []string{"docker.io/library"}, true},
+		{"nginx", []string{"docker.io/lib"}, false},
+		{"quay.io/team/app", []string{"docker.io/", "quay.io"}, true},
+		{"quay.io/team/app", []string{"docker.io/"}, false},
+	}
+	for _, test := range tests {
+		got := allowedRegistry(test.image, test.registries) == ""
+		if got != test.allowed {
+			t.Errorf("%s with %v: got allowed %v, want %v", test.image, test.registries, got, test.allowed)
+		}
+	}
+}
+
+// checkPod runs the rule against a Deployment with the pod spec.
+func checkPod(t *testing.T, rule Rule, spec string) []string {
+	t.Helper()
+	g, err := NewGeneric(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+`+indentLines(spec, "      "), util.Config{Namespace: "shop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages, err := rule.Check(&g.Data[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return messages
+}
+
+func indentLines(s, prefix string) string {
+	lines := strings.Split(strings.Trim(s, "\n"), "\n")
+	for i := range lines {
+		lines[i] = prefix + lines[i]
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func TestBuiltinRules(t *testing.T) {
+	tests := []struct {
+		rule string
+		spec string
+		want []string
+	}{
+		{"no-latest", `containers: [{name: a, image: "app:1.2"}, {name: b, image: "app@` + testDigest + `"}]`, nil},
+		{"no-latest", `containers: [{name: a, image: app}, {name: b, image: "app:latest"}]`, []string{
+			"container a: image app uses the latest tag", "container b: image app:latest uses the latest tag"}},
+		{"no-latest", `{initContainers: [{name: init, image: "tool:latest"}], containers: [{name: a, image: "app:1"}]}`, []string{
+			"container init: image tool:latest uses the latest tag"}},
+
+		{"no-privileged", `containers: [{name: a, image: app, securityContext: {privileged: false}}, {name: b, image: app}]`, nil},
+		{"no-privileged", `containers: [{name: a, image: app, securityContext: {privileged: true}}]`, []string{"container a: runs privileged"}},
+
+		{"resource-limits", `containers: [{name: a, image: app, resources: {limits: {cpu: 100m, memory: 64Mi}}}]`, nil},
+		{"resource-limits", `containers: [{name: a, image: app, resources: {limits: {cpu: 100m}, requests: {memory: 64Mi}}}]`, []string{
+			"container a: has no memory limit"}},
+		{"resource-limits", `containers: [{name: a, image: app}]`, []string{"container a: has no cpu and memory limit"}},
+
+		{"run-as-non-root", `containers: [{name: a, image: app, securityContext: {runAsNonRoot: true}}]`, nil},
+		{"run-as-non-root", `{securityContext: {runAsNonRoot: true}, containers: [{name: a, image: app}]}`, nil},
+		{"run-as-non-root", `{securityContext: {runAsNonRoot: true}, containers: [{name: a, image: app, securityContext: {runAsNonRoot: false}}]}`, []string{
+			"container a: does not set runAsNonRoot"}},
+		{"run-as-non-root", `{securityContext: {runAsNonRoot: false}, containers: [{name: a, image: app, securityContext: {runAsNonRoot: true}}]}`, nil},
+		{"run-as-non-root", `containers: [{name: a, image: app}]`, []string{"container a: does not set runAsNonRoot"}},
+	}
+	for _, test := range tests {
+		rule, err := BuiltinRule(test.rule, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := checkPod(t, rule, test.spec); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s %s: got %q, want %q", test.rule, test.spec, got, test.want)
+		}
+	}
+
+	if _, err := BuiltinRule("allowed-registries", nil); err == nil {
+		t.Error("expected allowed-registries to need registries")
+	}
+	if _, err := BuiltinRule("no-such-rule", nil); err == nil {
+		t.Error("expected an error for an unknown rule")
+	}
+}
+
+func TestRegoRule(t *testing.T) {
+	rule, err := RegoRule("kube", `package kube
+
+deny[msg] {
+  input.kind == "Deployment"
+  input.spec.replicas > 10
+  msg := sprintf("%d replicas, at most 10 are allowed", [input.spec.replicas])
+}
+
+deny[msg] {
+  c := input.spec.template.spec.containers[_]
+  not startswith(c.image, "ccr.ccs.tencentyun.com/")
+  msg := sprintf("image %s is not from our registry", [c.image])
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewGeneric(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 12
+  template:
+    spec:
+      containers: [{name: web, image: nginx}]
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers: [{name: api, image: ccr.ccs.tencentyun.com/team/api:1}]
+`, util.Config{Namespace: "shop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	violations, err := g.Check([]Rule{rule})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Violation{
+		{Object: describe(&g.Data[0]), Rule: "kube", Message: "12 replicas, at most 10 are allowed"},
+		{Object: describe(&g.Data[0]), Rule: "kube", Message: "image nginx is not from our registry"},
+	}
+	if !reflect.DeepEqual(violations, want) {
+		t.Errorf("got %+v, want %+v", violations, want)
+	}
+}
+
+func TestRegoRuleErrors(t *testing.T) {
+	tests := map[string]string{
+		"empty":   "",
+		"syntax":  "package kube\ndeny[msg] {",
+		"no deny": "package kube\nallow { true }",
+	}
+	for name, module := range tests {
+		if _, err := RegoRule(name, module); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestReportViolations(t *testing.T) {
+	violations := []Violation{
+		{Object: "deployment web", Rule: "no-latest", Message: "container web: image app uses the latest tag"},
+		{Object: "deployment web", Rule: "no-privileged", Message: "container web: runs privileged"},
+		{Object: "service web", Rule: "kube", Message: "service web must not be a LoadBalancer"},
+	}
+	if err := ReportViolations(nil, false); err != nil {
+		t.Errorf("no violations: %v", err)
+	}
+	err := ReportViolations(violations, false)
+	if err == nil || err.Error() != "3 policy violations in 2 objects" {
+		t.Errorf("got %v, want 3 policy violations in 2 objects", err)
+	}
+	if err = ReportViolations(violations, true); err != nil {
+		t.Errorf("warn: %v", err)
+	}
+}
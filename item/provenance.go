@@ -0,0 +1,55 @@
+package item
+
+import (
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// annotation kubectl rollout history shows for every revision
+const ChangeCauseAnnotation = "kubernetes.io/change-cause"
+
+// Annotate adds the annotations to every object and to the pod template of
+// the workloads, leaving out empty values. The change cause only goes on the
+// objects, where the rollout history reads it from.
+func (g *Generic) Annotate(annotations map[string]string, changeCause string) error {
+	for i := range g.Data {
+		obj := &g.Data[i]
+
+		current := obj.GetAnnotations()
+		if current == nil {
+			current = map[string]string{}
+		}
+		mergeAnnotations(current, annotations)
+		if changeCause != "" {
+			current[ChangeCauseAnnotation] = changeCause
+		}
+		obj.SetAnnotations(current)
+
+		template := podTemplatePath(obj.GetKind())
+		if template == nil {
+			continue
+		}
+		path := append(template, "metadata", "annotations")
+		podAnnotations, _, err := unstructured.NestedStringMap(obj.Object, path...)
+		if err != nil {
+			return errors.Wrapf(err, "invalid pod template annotations in %s", describe(obj))
+		}
+		if podAnnotations == nil {
+			podAnnotations = map[string]string{}
+		}
+		mergeAnnotations(podAnnotations, annotations)
+		if err = unstructured.SetNestedStringMap(obj.Object, podAnnotations, path...); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+func mergeAnnotations(dst, src map[string]string) {
+	for k, v := range src {
+		if v != "" {
+			dst[k] = v
+		}
+	}
+}
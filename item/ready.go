@@ -0,0 +1,261 @@
+package item
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/api/apps/v1beta1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+)
+
+// WaitAll in wait_for waits for every object that reports readiness.
+const WaitAll = "all"
+
+var endpointsResource = schema.GroupVersionResource{Version: "v1", Resource: "endpoints"}
+
+// WaitReady blocks until every applied object of the kinds to wait for is
+// ready, or fails once timeout is reached. Kinds are matched ignoring case;
+// with WaitAll the objects of kinds without a readiness check are only
+// waited for when they have status conditions. The outcome is added to the
+// Results of the objects.
+func (g *Generic) WaitReady(kinds []string, timeout time.Duration, client dynamic.Interface, mapper meta.RESTMapper) error {
+	all := false
+	wanted := map[string]bool{}
+	for _, kind := range kinds {
+		if strings.EqualFold(kind, WaitAll) {
+			all = true
+		}
+		wanted[strings.ToLower(kind)] = true
+	}
+
+	var pending []int
+	for i := range g.Data {
+		if all || wanted[strings.ToLower(g.Data[i].GetKind())] {
+			pending = append(pending, i)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	log.Printf("wait for %d objects to be ready", len(pending))
+
+	started := time.Now()
+	reasons := map[int]string{}
+	err := wait.PollImmediate(2*time.Second, timeout, func() (bool, error) {
+		var waiting []int
+		for _, i := range pending {
+			obj := &g.Data[i]
+			res, err := g.resourceFor(obj, client, mapper)
+			if err != nil {
+				return false, err
+			}
+			live, err := res.Get(obj.GetName(), metaV1.GetOptions{})
+			if err != nil {
+				return false, errors.Wrapf(err, "cannot get %s", describe(obj))
+			}
+			ready, reason, err := readiness(live, !all || wanted[strings.ToLower(obj.GetKind())], client)
+			if err != nil {
+				g.setRollout(i, "failed: "+err.Error(), started)
+				return false, err
+			}
+			if !ready {
+				reasons[i] = reason
+				waiting = append(waiting, i)
+				continue
+			}
+			log.Println(describe(obj) + " is ready")
+			g.setRollout(i, "complete", started)
+		}
+		pending = waiting
+		return len(pending) == 0, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		var waiting []string
+		for _, i := range pending {
+			msg := describe(&g.Data[i]) + ": " + reasons[i]
+			g.setRollout(i, "failed: "+msg, started)
+			waiting = append(waiting, msg)
+		}
+		return errors.Errorf("not ready after %s: %s", timeout, strings.Join(waiting, "; "))
+	}
+	return err
+}
+
+// setRollout sets the outcome of waiting on the result of the i-th object.
+func (g *Generic) setRollout(i int, rollout string, started time.Time) {
+	if i < len(g.Results) {
+		g.Results[i].Rollout = rollout
+		g.Results[i].RolloutSeconds = time.Since(started).Seconds()
+	}
+}
+
+// readiness tells whether a live object is ready, and if not why. Kinds
+// without a check of their own are ready once their Ready condition is true;
+// when there is no such condition yet they are ready unless strict.
+func readiness(obj *unstructured.Unstructured, strict bool, client dynamic.Interface) (bool, string, error) {
+	switch obj.GetKind() {
+	case "Deployment":
+		deploy := &v1beta1.Deployment{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, deploy); err != nil {
+			return false, "", errors.WithStack(err)
+		}
+		return rolloutStatus(deploy)
+	case "StatefulSet":
+		return statefulSetReady(obj)
+	case "DaemonSet":
+		return daemonSetReady(obj)
+	case "Job":
+		return jobReady(obj)
+	case "PersistentVolumeClaim":
+		if phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase"); phase != "Bound" {
+			return false, "waiting for the claim to be bound", nil
+		}
+		return true, "", nil
+	case "Service":
+		return serviceReady(obj, client)
+	case "Ingress":
+		if !hasLoadBalancerIngress(obj) {
+			return false, "waiting for an address to be assigned", nil
+		}
+		return true, "", nil
+	}
+	return conditionReady(obj, strict)
+}
+
+// statefulSetReady mirrors the checks of `kubectl rollout status`.
+func statefulSetReady(obj *unstructured.Unstructured) (bool, string, error) {
+	if observed, _, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration"); obj.GetGeneration() > observed {
+		return false, "waiting for the statefulset spec update to be observed", nil
+	}
+	if strategy, _, _ := unstructured.NestedString(obj.Object, "spec", "updateStrategy", "type"); strategy == "OnDelete" {
+		return true, "", nil
+	}
+	replicas, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	if !found {
+		replicas = 1
+	}
+	ready, _, _ := unstructured.NestedInt64(obj.Object, "status", "readyReplicas")
+	if ready < replicas {
+		return false, fmt.Sprintf("%d of %d pods are ready", ready, replicas), nil
+	}
+	if partition, found, _ := unstructured.NestedInt64(obj.Object, "spec", "updateStrategy", "rollingUpdate", "partition"); found && partition > 0 {
+		updated, _, _ := unstructured.NestedInt64(obj.Object, "status", "updatedReplicas")
+		if updated < replicas-partition {
+			return false, fmt.Sprintf("%d of %d pods above the partition have been updated", updated, replicas-partition), nil
+		}
+		return true, "", nil
+	}
+	current, _, _ := unstructured.NestedString(obj.Object, "status", "currentRevision")
+	update, _, _ := unstructured.NestedString(obj.Object, "status", "updateRevision")
+	if current != update {
+		return false, "waiting for the rolling update to complete", nil
+	}
+	return true, "", nil
+}
+
+// daemonSetReady mirrors the checks of `kubectl rollout status`.
+func daemonSetReady(obj *unstructured.Unstructured) (bool, string, error) {
+	if observed, _, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration"); obj.GetGeneration() > observed {
+		return false, "waiting for the daemonset spec update to be observed", nil
+	}
+	if strategy, _, _ := unstructured.NestedString(obj.Object, "spec", "updateStrategy", "type"); strategy == "OnDelete" {
+		return true, "", nil
+	}
+	desired, _, _ := unstructured.NestedInt64(obj.Object, "status", "desiredNumberScheduled")
+	updated, _, _ := unstructured.NestedInt64(obj.Object, "status", "updatedNumberScheduled")
+	if updated < desired {
+		return false, fmt.Sprintf("%d out of %d new pods have been updated", updated, desired), nil
+	}
+	available, _, _ := unstructured.NestedInt64(obj.Object, "status", "numberAvailable")
+	if available < desired {
+		return false, fmt.Sprintf("%d of %d updated pods are available", available, desired), nil
+	}
+	return true, "", nil
+}
+
+// a job is ready once it succeeded, and fails the wait when it failed
+func jobReady(obj *unstructured.Unstructured) (bool, string, error) {
+	if conditionTrue(obj, "Failed") {
+		return false, "", errors.Errorf("job %s failed", obj.GetName())
+	}
+	if conditionTrue(obj, "Complete") {
+		return true, "", nil
+	}
+	return false, "waiting for the job to succeed", nil
+}
+
+// a service is ready once it has endpoints, a load balancer once it has an
+// ingress address too; services without a selector are ready right away
+func serviceReady(obj *unstructured.Unstructured, client dynamic.Interface) (bool, string, error) {
+	kind, _, _ := unstructured.NestedString(obj.Object, "spec", "type")
+	if kind == "ExternalName" {
+		return true, "", nil
+	}
+	if kind == "LoadBalancer" && !hasLoadBalancerIngress(obj) {
+		return false, "waiting for a load balancer address to be assigned", nil
+	}
+	if selector, _, _ := unstructured.NestedMap(obj.Object, "spec", "selector"); len(selector) == 0 {
+		return true, "", nil
+	}
+
+	endpoints, err := client.Resource(endpointsResource).Namespace(obj.GetNamespace()).Get(obj.GetName(), metaV1.GetOptions{})
+	if err != nil {
+		return false, "waiting for endpoints", nil
+	}
+	subsets, _, _ := unstructured.NestedSlice(endpoints.Object, "subsets")
+	for _, s := range subsets {
+		if subset, ok := s.(map[string]interface{}); ok {
+			if addresses, _, _ := unstructured.NestedSlice(subset, "addresses"); len(addresses) > 0 {
+				return true, "", nil
+			}
+		}
+	}
+	return false, "waiting for endpoints", nil
+}
+
+func hasLoadBalancerIngress(obj *unstructured.Unstructured) bool {
+	ingress, _, _ := unstructured.NestedSlice(obj.Object, "status", "loadBalancer", "ingress")
+	return len(ingress) > 0
+}
+
+func conditionReady(obj *unstructured.Unstructured, strict bool) (bool, string, error) {
+	if observed, found, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration"); found && obj.GetGeneration() > observed {
+		return false, "waiting for the spec update to be observed", nil
+	}
+	if _, found := condition(obj, "Ready"); !found {
+		if strict {
+			return false, "waiting for a Ready condition", nil
+		}
+		return true, "", nil
+	}
+	if !conditionTrue(obj, "Ready") {
+		return false, "waiting for the Ready condition to be true", nil
+	}
+	return true, "", nil
+}
+
+func conditionTrue(obj *unstructured.Unstructured, kind string) bool {
+	status, _ := condition(obj, kind)
+	return status == "True"
+}
+
+// condition returns the status of the condition of that type.
+func condition(obj *unstructured.Unstructured, kind string) (string, bool) {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		if c, ok := c.(map[string]interface{}); ok && c["type"] == kind {
+			status, _ := c["status"].(string)
+			return status, true
+		}
+	}
+	return "", false
+}
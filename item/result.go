@@ -0,0 +1,84 @@
+package item
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// what happened to an object
+const (
+	ActionCreated   = "created"
+	ActionUpdated   = "updated"
+	ActionUnchanged = "unchanged"
+	ActionDeleted   = "deleted"
+	ActionAbsent    = "absent"
+	ActionFailed    = "failed"
+)
+
+// Result is what a run did to a single object, for the deploy report.
+type Result struct {
+	APIVersion string    `json:"api_version"`
+	Kind       string    `json:"kind"`
+	Namespace  string    `json:"namespace,omitempty"`
+	Name       string    `json:"name"`
+	UID        types.UID `json:"uid,omitempty"`
+	Action     string    `json:"action"`
+	Error      string    `json:"error,omitempty"`
+
+	OldResourceVersion string   `json:"old_resource_version,omitempty"`
+	NewResourceVersion string   `json:"new_resource_version,omitempty"`
+	OldImages          []string `json:"old_images,omitempty"`
+	NewImages          []string `json:"new_images,omitempty"`
+
+	// set for the workloads that were waited for
+	Rollout        string  `json:"rollout,omitempty"`
+	ApplySeconds   float64 `json:"apply_seconds"`
+	RolloutSeconds float64 `json:"rollout_seconds,omitempty"`
+}
+
+// live sets what the api server returned for the object, its namespace is
+// empty for kinds that are not namespaced.
+func (r *Result) live(obj *unstructured.Unstructured) {
+	r.Namespace = obj.GetNamespace()
+	r.UID = obj.GetUID()
+	r.NewResourceVersion = obj.GetResourceVersion()
+}
+
+func newResult(obj *unstructured.Unstructured, namespace string) Result {
+	return Result{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Namespace:  namespace,
+		Name:       obj.GetName(),
+		NewImages:  images(obj),
+	}
+}
+
+// images lists the container images of a workload or pod, init containers
+// first.
+func images(obj *unstructured.Unstructured) []string {
+	spec, _, err := podSpec(obj)
+	if err != nil || spec == nil {
+		return nil
+	}
+	var list []string
+	for _, c := range append(spec.InitContainers, spec.Containers...) {
+		list = append(list, c.Image)
+	}
+	return list
+}
+
+// Images lists the container images of all the workloads, once each.
+func (g *Generic) Images() []string {
+	seen := map[string]bool{}
+	var list []string
+	for i := range g.Data {
+		for _, image := range images(&g.Data[i]) {
+			if !seen[image] {
+				seen[image] = true
+				list = append(list, image)
+			}
+		}
+	}
+	return list
+}
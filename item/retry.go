@@ -0,0 +1,82 @@
+package item
+
+import (
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/goerzh/drone-kube/util"
+	"github.com/pkg/errors"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// RetryPolicy is how often and how long api calls are retried when they
+// fail for a reason that may go away, like a conflict with a controller
+// writing the same object, throttling or a connection reset.
+type RetryPolicy struct {
+	Attempts int
+	Deadline time.Duration
+}
+
+// NewRetryPolicy returns the retry settings of the plugin.
+func NewRetryPolicy(cfg util.Config) RetryPolicy {
+	return RetryPolicy{Attempts: cfg.RetryAttempts, Deadline: cfg.RetryDeadline}
+}
+
+// Do calls fn until it succeeds, fails for good, runs out of attempts or
+// the next attempt would be past the deadline, which counts from the first
+// attempt and so bounds all the attempts of the call together. The delay starts at half a
+// second and doubles, with jitter, up to 30s. fn has to fetch the live
+// object again itself, so a conflict is resolved against its latest version.
+func (r RetryPolicy) Do(fn func() error) error {
+	backoff := wait.Backoff{
+		Duration: 500 * time.Millisecond,
+		Factor:   2,
+		Jitter:   0.5,
+		Steps:    r.Attempts,
+		Cap:      30 * time.Second,
+	}
+	deadline := time.Now().Add(r.Deadline)
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !Transient(err) || attempt >= r.Attempts {
+			return err
+		}
+		delay := backoff.Step()
+		if r.Deadline > 0 && time.Now().Add(delay).After(deadline) {
+			return errors.Wrapf(err, "giving up after %d attempts, the retry deadline of %s is reached", attempt, r.Deadline)
+		}
+		log.Printf("%s, retrying in %s", err, delay.Round(time.Millisecond))
+		time.Sleep(delay)
+	}
+}
+
+// Transient tells whether an api call failed for a reason that may go away
+// when it is tried again.
+func Transient(err error) bool {
+	err = errors.Cause(err)
+	switch {
+	case kubeerrors.IsConflict(err),
+		kubeerrors.IsTooManyRequests(err),
+		kubeerrors.IsServerTimeout(err),
+		kubeerrors.IsTimeout(err),
+		kubeerrors.IsServiceUnavailable(err),
+		kubeerrors.IsInternalError(err),
+		kubeerrors.IsUnexpectedServerError(err):
+		return true
+	case utilnet.IsConnectionReset(err), utilnet.IsProbableEOF(err), err == io.ErrUnexpectedEOF:
+		return true
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return true
+	}
+	// etcd errors and connections refused while the api server restarts
+	// only show in the message
+	msg := err.Error()
+	return strings.Contains(msg, "etcdserver: request timed out") || strings.Contains(msg, "etcdserver: leader changed") ||
+		strings.Contains(msg, "connection refused")
+}
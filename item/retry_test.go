@@ -0,0 +1,51 @@
+package item
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestRetryDo(t *testing.T) {
+	conflict := kubeerrors.NewConflict(schema.GroupResource{Resource: "deployments"}, "web", errors.New("changed"))
+	invalid := kubeerrors.NewBadRequest("invalid")
+
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		err    error
+		calls  int
+	}{
+		{"transient", RetryPolicy{Attempts: 2, Deadline: time.Minute}, conflict, 2},
+		{"permanent", RetryPolicy{Attempts: 3, Deadline: time.Minute}, invalid, 1},
+		// the first delay is at least half a second
+		{"deadline", RetryPolicy{Attempts: 3, Deadline: 100 * time.Millisecond}, conflict, 1},
+	}
+	for _, test := range tests {
+		calls := 0
+		err := test.policy.Do(func() error {
+			calls++
+			return test.err
+		})
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+		if calls != test.calls {
+			t.Errorf("%s: got %d calls, want %d", test.name, calls, test.calls)
+		}
+	}
+
+	calls := 0
+	err := RetryPolicy{Attempts: 3, Deadline: time.Minute}.Do(func() error {
+		if calls++; calls == 1 {
+			return conflict
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("got %v after %d calls, want success after 2", err, calls)
+	}
+}
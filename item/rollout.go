@@ -0,0 +1,279 @@
+package item
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	appsV1 "k8s.io/api/apps/v1"
+	"k8s.io/api/apps/v1beta1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+const RestartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// Restart triggers a new rollout of a deployment the way
+// `kubectl rollout restart` does, by stamping its pod template.
+func Restart(name string, namespace string, retry RetryPolicy, client *kubernetes.Clientset) error {
+	patch := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]string{
+						RestartedAtAnnotation: time.Now().Format(time.RFC3339),
+					},
+				},
+			},
+		},
+	}
+	if err := patchDeployment(name, namespace, patch, retry, client); err != nil {
+		return err
+	}
+	log.Println("restart deployment " + name)
+	return nil
+}
+
+// Scale sets the number of replicas of a deployment.
+func Scale(name string, namespace string, replicas int32, retry RetryPolicy, client *kubernetes.Clientset) error {
+	patch := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"replicas": replicas,
+		},
+	}
+	if err := patchDeployment(name, namespace, patch, retry, client); err != nil {
+		return err
+	}
+	log.Printf("scale deployment %s to %d replicas", name, replicas)
+	return nil
+}
+
+// Pause stops the controller from rolling out changes to the deployment.
+func Pause(name string, namespace string, retry RetryPolicy, client *kubernetes.Clientset) error {
+	return setPaused(name, namespace, true, retry, client)
+}
+
+// Resume continues a paused rollout.
+func Resume(name string, namespace string, retry RetryPolicy, client *kubernetes.Clientset) error {
+	return setPaused(name, namespace, false, retry, client)
+}
+
+func setPaused(name string, namespace string, paused bool, retry RetryPolicy, client *kubernetes.Clientset) error {
+	patch := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"paused": paused,
+		},
+	}
+	if err := patchDeployment(name, namespace, patch, retry, client); err != nil {
+		return err
+	}
+	if paused {
+		log.Println("pause deployment " + name)
+	} else {
+		log.Println("resume deployment " + name)
+	}
+	return nil
+}
+
+// Status prints the rollout state of a deployment.
+func Status(name string, namespace string, client *kubernetes.Clientset) error {
+	deploy, err := client.AppsV1beta1().Deployments(namespace).Get(name, metaV1.GetOptions{})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	replicas := int32(1)
+	if deploy.Spec.Replicas != nil {
+		replicas = *deploy.Spec.Replicas
+	}
+	log.Printf("deployment %s: %d desired, %d updated, %d ready, %d available, paused=%t",
+		name, replicas, deploy.Status.UpdatedReplicas, deploy.Status.ReadyReplicas,
+		deploy.Status.AvailableReplicas, deploy.Spec.Paused)
+	for _, c := range deploy.Spec.Template.Spec.Containers {
+		log.Printf("deployment %s: container %s runs %s", name, c.Name, c.Image)
+	}
+	if done, reason, err := rolloutStatus(deploy); err != nil {
+		log.Printf("deployment %s: %s", name, err)
+	} else if !done {
+		log.Printf("deployment %s: %s", name, reason)
+	}
+	return nil
+}
+
+func patchDeployment(name string, namespace string, patch map[string]interface{}, retry RetryPolicy, client *kubernetes.Clientset) error {
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	err = retry.Do(func() error {
+		_, err := client.AppsV1beta1().Deployments(namespace).Patch(name, types.StrategicMergePatchType, data)
+		return err
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// WaitRollout blocks until every replica of the deployment runs the current
+// pod template, or fails once timeout is reached.
+func WaitRollout(name string, namespace string, timeout time.Duration, client *kubernetes.Clientset) error {
+	log.Println("wait for rollout of deployment " + name)
+	var reason string
+	err := wait.PollImmediate(2*time.Second, timeout, func() (bool, error) {
+		deploy, err := client.AppsV1beta1().Deployments(namespace).Get(name, metaV1.GetOptions{})
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+		var done bool
+		done, reason, err = rolloutStatus(deploy)
+		return done, err
+	})
+	if err == wait.ErrWaitTimeout {
+		return errors.Errorf("rollout of deployment %s timed out after %s: %s", name, timeout, reason)
+	}
+	if err != nil {
+		return err
+	}
+	log.Println("deployment " + name + " successfully rolled out")
+	return nil
+}
+
+// rolloutStatus mirrors the checks of `kubectl rollout status`.
+func rolloutStatus(deploy *v1beta1.Deployment) (bool, string, error) {
+	if deploy.Generation > deploy.Status.ObservedGeneration {
+		return false, "waiting for the deployment spec update to be observed", nil
+	}
+	for _, cond := range deploy.Status.Conditions {
+		if cond.Type == v1beta1.DeploymentProgressing && cond.Reason == "ProgressDeadlineExceeded" {
+			return false, "", errors.Errorf("deployment %s exceeded its progress deadline", deploy.Name)
+		}
+	}
+	replicas := int32(1)
+	if deploy.Spec.Replicas != nil {
+		replicas = *deploy.Spec.Replicas
+	}
+	if deploy.Status.UpdatedReplicas < replicas {
+		return false, fmt.Sprintf("%d out of %d new replicas have been updated", deploy.Status.UpdatedReplicas, replicas), nil
+	}
+	if deploy.Status.Replicas > deploy.Status.UpdatedReplicas {
+		return false, fmt.Sprintf("%d old replicas are pending termination", deploy.Status.Replicas-deploy.Status.UpdatedReplicas), nil
+	}
+	if deploy.Status.AvailableReplicas < deploy.Status.UpdatedReplicas {
+		return false, fmt.Sprintf("%d of %d updated replicas are available", deploy.Status.AvailableReplicas, deploy.Status.UpdatedReplicas), nil
+	}
+	return true, "", nil
+}
+
+// RevisionAnnotation numbers the rollouts of a deployment and its replica sets.
+const RevisionAnnotation = "deployment.kubernetes.io/revision"
+
+// Revision returns the current revision of a deployment, 0 when it does not
+// exist or was never rolled out.
+func Revision(name string, namespace string, client *kubernetes.Clientset) (int64, error) {
+	deploy, err := client.AppsV1beta1().Deployments(namespace).Get(name, metaV1.GetOptions{})
+	if kubeerrors.IsNotFound(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	revision, _ := strconv.ParseInt(deploy.Annotations[RevisionAnnotation], 10, 64)
+	return revision, nil
+}
+
+// Rollback returns a deployment to its previous pod template the way
+// `kubectl rollout undo` does, from the replica set of the revision before
+// the current one.
+func Rollback(name string, namespace string, retry RetryPolicy, client *kubernetes.Clientset) error {
+	deploy, err := client.AppsV1beta1().Deployments(namespace).Get(name, metaV1.GetOptions{})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	selector, err := metaV1.LabelSelectorAsSelector(deploy.Spec.Selector)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	sets, err := client.AppsV1().ReplicaSets(namespace).List(metaV1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	current, _ := strconv.ParseInt(deploy.Annotations[RevisionAnnotation], 10, 64)
+	var previous *appsV1.ReplicaSet
+	revision := int64(0)
+	for i := range sets.Items {
+		rs := &sets.Items[i]
+		if owner := metaV1.GetControllerOf(rs); owner == nil || owner.UID != deploy.UID {
+			continue
+		}
+		r, err := strconv.ParseInt(rs.Annotations[RevisionAnnotation], 10, 64)
+		if err != nil || r >= current || r <= revision {
+			continue
+		}
+		previous, revision = rs, r
+	}
+	if previous == nil {
+		return errors.Errorf("deployment %s has no previous revision to roll back to", name)
+	}
+
+	template := previous.Spec.Template.DeepCopy()
+	delete(template.Labels, appsV1.DefaultDeploymentUniqueLabelKey)
+	data, err := json.Marshal([]map[string]interface{}{
+		{"op": "replace", "path": "/spec/template", "value": template},
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	err = retry.Do(func() error {
+		_, err := client.AppsV1beta1().Deployments(namespace).Patch(name, types.JSONPatchType, data)
+		return err
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	log.Printf("roll back deployment %s to revision %d", name, revision)
+	return nil
+}
+
+// WaitDeleted blocks until the deployment is gone, or fails once timeout is
+// reached.
+func WaitDeleted(name string, namespace string, timeout time.Duration, client *kubernetes.Clientset) error {
+	err := wait.PollImmediate(2*time.Second, timeout, func() (bool, error) {
+		_, err := client.AppsV1beta1().Deployments(namespace).Get(name, metaV1.GetOptions{})
+		if kubeerrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+	if err == wait.ErrWaitTimeout {
+		return errors.Errorf("deployment %s still exists after %s", name, timeout)
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// Delete removes a deployment, by default together with its replica sets and pods.
+func Delete(name string, namespace string, propagation string, retry RetryPolicy, client *kubernetes.Clientset) error {
+	policy := PropagationPolicy(propagation)
+	err := retry.Do(func() error {
+		return client.AppsV1beta1().Deployments(namespace).Delete(name, &metaV1.DeleteOptions{PropagationPolicy: &policy})
+	})
+	if kubeerrors.IsNotFound(err) {
+		log.Println("deployment " + name + " already absent")
+		return nil
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	log.Println("delete deployment " + name)
+	return nil
+}
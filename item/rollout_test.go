@@ -0,0 +1,31 @@
+package item
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeleteDeploymentAbsent(t *testing.T) {
+	var requests []string
+	client := fakeAPIServer(t, func(r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, strings.TrimSpace(r.Method+" "+r.URL.Path+" "+string(body)))
+	})
+
+	if err := Delete("web", "shop", "orphan", RetryPolicy{}, client); err != nil {
+		t.Fatal(err)
+	}
+	if err := WaitDeleted("web", "shop", time.Second, client); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`DELETE /apis/apps/v1beta1/namespaces/shop/deployments/web {"kind":"DeleteOptions","apiVersion":"apps/v1beta1","propagationPolicy":"Orphan"}`,
+		"GET /apis/apps/v1beta1/namespaces/shop/deployments/web",
+	}
+	if strings.Join(requests, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q, want %q", requests, want)
+	}
+}
@@ -0,0 +1,63 @@
+package item
+
+import (
+	"encoding/base64"
+
+	"github.com/goerzh/drone-kube/secret"
+	"github.com/goerzh/drone-kube/util"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Decrypt decrypts the sops documents and the age or PGP encrypted values
+// of the objects. keys may be nil when nothing is encrypted.
+func (g *Generic) Decrypt(keys *secret.Keyring) error {
+	for i := range g.Data {
+		obj := &g.Data[i]
+		if err := keys.DecryptObject(obj.Object); err != nil {
+			return errors.Wrapf(err, "cannot decrypt %s", describe(obj))
+		}
+	}
+	return nil
+}
+
+// Sensitive marks the values of the Secrets as sensitive, so they are masked
+// wherever they would show up in the build logs.
+func (g *Generic) Sensitive() {
+	for _, obj := range g.Data {
+		if obj.GetKind() != "Secret" {
+			continue
+		}
+		data, _, _ := unstructured.NestedStringMap(obj.Object, "data")
+		for _, v := range data {
+			util.Sensitive(v)
+			if decoded, err := base64.StdEncoding.DecodeString(v); err == nil {
+				util.Sensitive(string(decoded))
+			}
+		}
+		stringData, _, _ := unstructured.NestedStringMap(obj.Object, "stringData")
+		for _, v := range stringData {
+			// the api server returns it as data, in errors too
+			util.Sensitive(v, base64.StdEncoding.EncodeToString([]byte(v)))
+		}
+	}
+}
+
+// Mask returns a copy of the object with the values of a Secret masked, for
+// output that may end up in build logs.
+func Mask(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	if obj.GetKind() != "Secret" {
+		return obj
+	}
+	masked := obj.DeepCopy()
+	for _, field := range []string{"data", "stringData"} {
+		values, ok := masked.Object[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for k := range values {
+			values[k] = util.Mask
+		}
+	}
+	return masked
+}
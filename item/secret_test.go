@@ -0,0 +1,25 @@
+package item
+
+import (
+	"testing"
+
+	"github.com/goerzh/drone-kube/util"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestGenericSensitive(t *testing.T) {
+	g := &Generic{Data: []unstructured.Unstructured{{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": "db"},
+		"data":       map[string]interface{}{"user": "cjBvdA=="}, // r0ot
+		"stringData": map[string]interface{}{"password": "p#1"},  // cCMx
+	}}}}
+	g.Sensitive()
+
+	for _, v := range []string{"cjBvdA==", "r0ot", "p#1", "cCMx"} {
+		if got := util.Redact("value " + v); got != "value "+util.Mask {
+			t.Errorf("%s is not masked: %q", v, got)
+		}
+	}
+}
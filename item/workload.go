@@ -0,0 +1,305 @@
+package item
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+
+	"github.com/goerzh/drone-kube/registry"
+	"github.com/pkg/errors"
+	coreV1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+)
+
+const ConfigHashAnnotation = "drone-kube/config-hash"
+
+// podTemplatePath returns where the pod template of a workload kind lives,
+// or nil for kinds that do not run pods.
+func podTemplatePath(kind string) []string {
+	switch kind {
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "ReplicationController", "Job":
+		return []string{"spec", "template"}
+	case "CronJob":
+		return []string{"spec", "jobTemplate", "spec", "template"}
+	}
+	return nil
+}
+
+// podSpec returns the pod spec of a workload or pod, converted to its type.
+func podSpec(obj *unstructured.Unstructured) (*coreV1.PodSpec, []string, error) {
+	path := []string{"spec"}
+	if obj.GetKind() != "Pod" {
+		template := podTemplatePath(obj.GetKind())
+		if template == nil {
+			return nil, nil, nil
+		}
+		path = append(template, "spec")
+	}
+	raw, found, err := unstructured.NestedMap(obj.Object, path...)
+	if err != nil || !found {
+		return nil, nil, errors.Wrapf(err, "%s has no pod spec", describe(obj))
+	}
+	spec := &coreV1.PodSpec{}
+	if err = runtime.DefaultUnstructuredConverter.FromUnstructured(raw, spec); err != nil {
+		return nil, nil, errors.Wrapf(err, "invalid pod spec in %s", describe(obj))
+	}
+	return spec, path, nil
+}
+
+// PinImages rewrites every container image of the workloads to the digest its
+// tag currently resolves to, using the image pull secrets they reference,
+// rendered along or in the cluster.
+func (g *Generic) PinImages(resolver *registry.Resolver, client *kubernetes.Clientset) error {
+	for i := range g.Data {
+		obj := &g.Data[i]
+		spec, path, err := podSpec(obj)
+		if err != nil {
+			return err
+		}
+		if spec == nil {
+			continue
+		}
+		namespace := g.namespace(obj)
+
+		for _, ref := range spec.ImagePullSecrets {
+			secret, err := g.secret(namespace, ref.Name, client)
+			if err != nil {
+				return err
+			}
+			if secret == nil {
+				log.Println("image pull secret " + ref.Name + " not found")
+				continue
+			}
+			for _, key := range []string{coreV1.DockerConfigJsonKey, coreV1.DockerConfigKey} {
+				if data, ok := secret.Data[key]; ok {
+					if err = resolver.AddDockerConfig(data); err != nil {
+						return errors.Wrapf(err, "image pull secret %s", ref.Name)
+					}
+				}
+			}
+		}
+
+		for _, field := range []string{"initContainers", "containers"} {
+			containers, found, err := unstructured.NestedSlice(obj.Object, append(path, field)...)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			if !found {
+				continue
+			}
+			for _, c := range containers {
+				container, ok := c.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				current, _ := container["image"].(string)
+				image, err := resolver.Resolve(current)
+				if err != nil {
+					return errors.WithStack(err)
+				}
+				if image != current {
+					log.Println("pin image " + current + " to " + image)
+					container["image"] = image
+				}
+			}
+			if err = unstructured.SetNestedSlice(obj.Object, containers, append(path, field)...); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// HashConfig stamps the pod template of the workloads with a hash of every
+// ConfigMap and Secret it references, so the pods are replaced exactly when
+// that config changes. The config is hashed as it is about to be applied when
+// it is rendered along, and as it is in the cluster otherwise.
+func (g *Generic) HashConfig(client *kubernetes.Clientset) error {
+	for i := range g.Data {
+		obj := &g.Data[i]
+		template := podTemplatePath(obj.GetKind())
+		if template == nil {
+			continue
+		}
+		spec, _, err := podSpec(obj)
+		if err != nil {
+			return err
+		}
+		namespace := g.namespace(obj)
+
+		configMaps, secrets := configRefs(spec)
+		hash := sha256.New()
+		for _, name := range configMaps {
+			cm, err := g.configMap(namespace, name, client)
+			if err != nil {
+				return err
+			}
+			if cm != nil {
+				writeHash(hash, "configmap/"+name, cm.Data, cm.BinaryData)
+			}
+		}
+		for _, name := range secrets {
+			secret, err := g.secret(namespace, name, client)
+			if err != nil {
+				return err
+			}
+			if secret != nil {
+				writeHash(hash, "secret/"+name, nil, secret.Data)
+			}
+		}
+
+		path := append(template, "metadata", "annotations", ConfigHashAnnotation)
+		if err = unstructured.SetNestedField(obj.Object, hex.EncodeToString(hash.Sum(nil)), path...); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// rendered returns the object of that kind, namespace and name among the
+// rendered ones, or nil.
+func (g *Generic) rendered(kind, namespace, name string) *unstructured.Unstructured {
+	for i := range g.Data {
+		obj := &g.Data[i]
+		if obj.GetKind() == kind && obj.GetName() == name && g.namespace(obj) == namespace {
+			return obj
+		}
+	}
+	return nil
+}
+
+// configMap returns a ConfigMap as it is about to be applied when it is
+// rendered, or as it is in the cluster. It is nil when it exists in neither.
+func (g *Generic) configMap(namespace, name string, client *kubernetes.Clientset) (*coreV1.ConfigMap, error) {
+	if obj := g.rendered("ConfigMap", namespace, name); obj != nil {
+		cm := &coreV1.ConfigMap{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, cm); err != nil {
+			return nil, errors.Wrapf(err, "invalid %s", describe(obj))
+		}
+		return cm, nil
+	}
+	cm, err := client.CoreV1().ConfigMaps(namespace).Get(name, metaV1.GetOptions{})
+	if kubeerrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return cm, nil
+}
+
+// secret returns a Secret as it is about to be applied when it is rendered,
+// with its stringData merged into data like the api server does, or as it is
+// in the cluster. It is nil when it exists in neither.
+func (g *Generic) secret(namespace, name string, client *kubernetes.Clientset) (*coreV1.Secret, error) {
+	if obj := g.rendered("Secret", namespace, name); obj != nil {
+		secret := &coreV1.Secret{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, secret); err != nil {
+			return nil, errors.Wrapf(err, "invalid %s", describe(obj))
+		}
+		if len(secret.StringData) > 0 && secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		for k, v := range secret.StringData {
+			secret.Data[k] = []byte(v)
+		}
+		secret.StringData = nil
+		return secret, nil
+	}
+	secret, err := client.CoreV1().Secrets(namespace).Get(name, metaV1.GetOptions{})
+	if kubeerrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return secret, nil
+}
+
+// configRefs lists the names of the ConfigMaps and Secrets a pod uses through
+// volumes, env and envFrom, sorted and without duplicates.
+func configRefs(spec *coreV1.PodSpec) ([]string, []string) {
+	configMaps := map[string]bool{}
+	secrets := map[string]bool{}
+
+	for _, vol := range spec.Volumes {
+		if vol.ConfigMap != nil {
+			configMaps[vol.ConfigMap.Name] = true
+		}
+		if vol.Secret != nil {
+			secrets[vol.Secret.SecretName] = true
+		}
+		if vol.Projected != nil {
+			for _, src := range vol.Projected.Sources {
+				if src.ConfigMap != nil {
+					configMaps[src.ConfigMap.Name] = true
+				}
+				if src.Secret != nil {
+					secrets[src.Secret.Name] = true
+				}
+			}
+		}
+	}
+	for _, containers := range [][]coreV1.Container{spec.InitContainers, spec.Containers} {
+		for _, c := range containers {
+			for _, from := range c.EnvFrom {
+				if from.ConfigMapRef != nil {
+					configMaps[from.ConfigMapRef.Name] = true
+				}
+				if from.SecretRef != nil {
+					secrets[from.SecretRef.Name] = true
+				}
+			}
+			for _, env := range c.Env {
+				if env.ValueFrom == nil {
+					continue
+				}
+				if env.ValueFrom.ConfigMapKeyRef != nil {
+					configMaps[env.ValueFrom.ConfigMapKeyRef.Name] = true
+				}
+				if env.ValueFrom.SecretKeyRef != nil {
+					secrets[env.ValueFrom.SecretKeyRef.Name] = true
+				}
+			}
+		}
+	}
+
+	return sortedKeys(configMaps), sortedKeys(secrets)
+}
+
+func writeHash(w io.Writer, name string, data map[string]string, binary map[string][]byte) {
+	fmt.Fprintf(w, "%s\n", name)
+	keys := make([]string, 0, len(data)+len(binary))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	for k := range binary {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if v, ok := data[k]; ok {
+			fmt.Fprintf(w, "%s=%d:%s\n", k, len(v), v)
+		} else {
+			fmt.Fprintf(w, "%s=%d:%s\n", k, len(binary[k]), binary[k])
+		}
+	}
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
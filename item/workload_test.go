@@ -0,0 +1,112 @@
+package item
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/goerzh/drone-kube/registry"
+	"github.com/goerzh/drone-kube/util"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const testDigest = "sha256:4a5b8c1e9f0d2c3b4a5b8c1e9f0d2c3b4a5b8c1e9f0d2c3b4a5b8c1e9f0d2c3b"
+
+// fakeAPIServer answers every request with not found, after handing it to
+// seen.
+func fakeAPIServer(t *testing.T, seen func(r *http.Request)) *kubernetes.Clientset {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen(r)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`)
+	}))
+	t.Cleanup(srv.Close)
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestPinImagesWithRenderedPullSecret(t *testing.T) {
+	reg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "pass" {
+			w.Header().Set("Www-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/v2/team/app/manifests/v1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", testDigest)
+	}))
+	defer reg.Close()
+	domain := strings.TrimPrefix(reg.URL, "http://")
+
+	client := fakeAPIServer(t, func(r *http.Request) {
+		if strings.Contains(r.URL.Path, "/secrets/") {
+			t.Errorf("the rendered pull secret should be used, got %s", r.URL.Path)
+		}
+	})
+	g, err := NewGeneric(fmt.Sprintf(`
+apiVersion: v1
+kind: Secret
+metadata:
+  name: pull
+type: kubernetes.io/dockerconfigjson
+stringData:
+  .dockerconfigjson: '{"auths":{"%[1]s":{"username":"user","password":"pass"}}}'
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      imagePullSecrets: [{name: pull}]
+      containers: [{name: web, image: "%[1]s/team/app:v1"}]
+`, domain), util.Config{Namespace: "default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = g.PinImages(registry.NewResolver(true), client); err != nil {
+		t.Fatal(err)
+	}
+	containers, _, _ := unstructured.NestedSlice(g.Data[1].Object, "spec", "template", "spec", "containers")
+	if got, want := containers[0].(map[string]interface{})["image"], domain+"/team/app@"+testDigest; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestPinImagesWithoutPullSecret(t *testing.T) {
+	var lookups []string
+	client := fakeAPIServer(t, func(r *http.Request) { lookups = append(lookups, r.URL.Path) })
+	g, err := NewGeneric(`
+apiVersion: v1
+kind: Pod
+metadata:
+  name: web
+spec:
+  imagePullSecrets: [{name: missing}]
+  containers: [{name: web, image: "app@`+testDigest+`"}]
+`, util.Config{Namespace: "shop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a missing pull secret is skipped, pinned images are left alone
+	if err = g.PinImages(registry.NewResolver(true), client); err != nil {
+		t.Fatal(err)
+	}
+	if len(lookups) != 1 || lookups[0] != "/api/v1/namespaces/shop/secrets/missing" {
+		t.Errorf("expected the pull secret to be looked up in the cluster, got %v", lookups)
+	}
+}
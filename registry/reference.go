@@ -0,0 +1,76 @@
+package registry
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultDomain = "docker.io"
+	defaultTag    = "latest"
+)
+
+// Reference is a parsed container image name.
+type Reference struct {
+	Domain string
+	Path   string
+	Tag    string
+	Digest string
+}
+
+// ParseReference splits an image name like ccr.ccs.tencentyun.com/team/app:v1
+// into its registry domain, repository path, tag and digest, applying the same
+// defaults as the docker cli (docker.io, library/ and latest).
+func ParseReference(image string) (*Reference, error) {
+	if image == "" {
+		return nil, errors.New("empty image name")
+	}
+	ref := &Reference{}
+	name := image
+	if i := strings.Index(name, "@"); i >= 0 {
+		ref.Digest = name[i+1:]
+		name = name[:i]
+	}
+	// a tag can only follow the last path component, the registry may have a port
+	if i := strings.LastIndex(name, ":"); i >= 0 && !strings.Contains(name[i+1:], "/") {
+		ref.Tag = name[i+1:]
+		name = name[:i]
+	}
+
+	i := strings.Index(name, "/")
+	if i < 0 || !strings.ContainsAny(name[:i], ".:") && name[:i] != "localhost" {
+		ref.Domain = defaultDomain
+		ref.Path = name
+	} else {
+		ref.Domain = name[:i]
+		ref.Path = name[i+1:]
+	}
+	if ref.Domain == defaultDomain && !strings.Contains(ref.Path, "/") {
+		ref.Path = "library/" + ref.Path
+	}
+	if ref.Path == "" {
+		return nil, errors.Errorf("invalid image name %q", image)
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = defaultTag
+	}
+	return ref, nil
+}
+
+// Name returns the repository name without tag or digest, as it was written
+// in a manifest (i.e. without the implicit docker.io/library/ prefix).
+func (r *Reference) Name() string {
+	if r.Domain == defaultDomain {
+		return strings.TrimPrefix(r.Path, "library/")
+	}
+	return r.Domain + "/" + r.Path
+}
+
+// String returns the full image name, pinned to the digest when one is known.
+func (r *Reference) String() string {
+	if r.Digest != "" {
+		return r.Name() + "@" + r.Digest
+	}
+	return r.Name() + ":" + r.Tag
+}
@@ -0,0 +1,326 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// manifest media types we accept, most specific first, so a multi-arch image
+// resolves to the digest of its manifest list rather than one platform.
+var manifestTypes = []string{
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+}
+
+type Credential struct {
+	Username string
+	Password string
+}
+
+// Resolver looks up the digest of image tags through the registry v2 api.
+type Resolver struct {
+	Client   *http.Client
+	Insecure bool
+
+	credentials map[string]Credential
+	digests     map[string]string
+}
+
+func NewResolver(insecure bool) *Resolver {
+	return &Resolver{
+		Client:      &http.Client{Timeout: 30 * time.Second},
+		Insecure:    insecure,
+		credentials: map[string]Credential{},
+		digests:     map[string]string{},
+	}
+}
+
+// SetCredential registers the login for a registry domain. An empty domain
+// sets the credential used for every registry without one of its own.
+func (r *Resolver) SetCredential(domain string, cred Credential) {
+	r.credentials[normalizeDomain(domain)] = cred
+}
+
+// AddDockerConfig registers the logins found in the content of a
+// .dockerconfigjson or legacy .dockercfg file, as stored in image pull secrets.
+func (r *Resolver) AddDockerConfig(data []byte) error {
+	type authEntry struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Auth     string `json:"auth"`
+	}
+	cfg := struct {
+		Auths map[string]authEntry `json:"auths"`
+	}{}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return errors.WithStack(err)
+	}
+	if cfg.Auths == nil {
+		// .dockercfg has the entries at the top level
+		if err := json.Unmarshal(data, &cfg.Auths); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	for domain, entry := range cfg.Auths {
+		cred := Credential{Username: entry.Username, Password: entry.Password}
+		if entry.Auth != "" {
+			raw, err := base64.StdEncoding.DecodeString(entry.Auth)
+			if err != nil {
+				return errors.Wrapf(err, "invalid auth for %s", domain)
+			}
+			parts := strings.SplitN(string(raw), ":", 2)
+			if len(parts) != 2 {
+				return errors.Errorf("invalid auth for %s", domain)
+			}
+			cred = Credential{Username: parts[0], Password: parts[1]}
+		}
+		r.SetCredential(domain, cred)
+	}
+	return nil
+}
+
+// Resolve returns the image pinned to the digest its tag currently points to.
+// Images that already carry a digest are returned unchanged.
+func (r *Resolver) Resolve(image string) (string, error) {
+	ref, err := ParseReference(image)
+	if err != nil {
+		return "", err
+	}
+	if ref.Digest != "" {
+		return image, nil
+	}
+	if digest, ok := r.digests[ref.String()]; ok {
+		ref.Digest = digest
+		return ref.String(), nil
+	}
+
+	digest, err := r.fetchDigest(ref)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot resolve %s", image)
+	}
+	r.digests[ref.String()] = digest
+	ref.Digest = digest
+	return ref.String(), nil
+}
+
+func (r *Resolver) fetchDigest(ref *Reference) (string, error) {
+	endpoint := fmt.Sprintf("%s://%s/v2/%s/manifests/%s", r.scheme(), r.host(ref.Domain), ref.Path, ref.Tag)
+
+	res, err := r.do(http.MethodHead, endpoint, ref)
+	if err != nil {
+		return "", err
+	}
+	res.Body.Close()
+	if digest := res.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+
+	// not every registry returns the digest header on HEAD, hash the manifest instead
+	res, err = r.do(http.MethodGet, endpoint, ref)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if digest := res.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(body)), nil
+}
+
+// do sends the manifest request, answering an authentication challenge once.
+func (r *Resolver) do(method, endpoint string, ref *Reference) (*http.Response, error) {
+	req, err := r.newRequest(method, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	res, err := r.Client.Do(req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if res.StatusCode == http.StatusUnauthorized {
+		res.Body.Close()
+		auth, err := r.authorize(res.Header.Get("Www-Authenticate"), ref)
+		if err != nil {
+			return nil, err
+		}
+		req, err = r.newRequest(method, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", auth)
+		res, err = r.Client.Do(req)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, errors.Errorf("%s %s: %s", method, endpoint, res.Status)
+	}
+	return res, nil
+}
+
+func (r *Resolver) newRequest(method, endpoint string) (*http.Request, error) {
+	req, err := http.NewRequest(method, endpoint, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req.Header.Set("Accept", strings.Join(manifestTypes, ", "))
+	return req, nil
+}
+
+// authorize builds the Authorization header for a WWW-Authenticate challenge.
+func (r *Resolver) authorize(challenge string, ref *Reference) (string, error) {
+	cred, hasCred := r.credential(ref.Domain)
+	scheme, params := parseChallenge(challenge)
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if !hasCred {
+			return "", errors.Errorf("registry %s requires credentials", ref.Domain)
+		}
+		return "Basic " + basicAuth(cred), nil
+
+	case "bearer":
+		realm, err := url.Parse(params["realm"])
+		if err != nil || params["realm"] == "" {
+			return "", errors.Errorf("invalid bearer realm %q", params["realm"])
+		}
+		q := realm.Query()
+		if params["service"] != "" {
+			q.Set("service", params["service"])
+		}
+		scope := params["scope"]
+		if scope == "" {
+			scope = fmt.Sprintf("repository:%s:pull", ref.Path)
+		}
+		q.Set("scope", scope)
+		realm.RawQuery = q.Encode()
+
+		req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		if hasCred {
+			req.SetBasicAuth(cred.Username, cred.Password)
+		}
+		res, err := r.Client.Do(req)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return "", errors.Errorf("token request to %s: %s", realm.Host, res.Status)
+		}
+		token := struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}{}
+		if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+			return "", errors.WithStack(err)
+		}
+		if token.Token == "" {
+			token.Token = token.AccessToken
+		}
+		return "Bearer " + token.Token, nil
+	}
+
+	return "", errors.Errorf("unsupported authentication challenge %q", challenge)
+}
+
+func (r *Resolver) credential(domain string) (Credential, bool) {
+	if cred, ok := r.credentials[normalizeDomain(domain)]; ok {
+		return cred, true
+	}
+	cred, ok := r.credentials[""]
+	return cred, ok
+}
+
+func (r *Resolver) scheme() string {
+	if r.Insecure {
+		return "http"
+	}
+	return "https"
+}
+
+func (r *Resolver) host(domain string) string {
+	if domain == defaultDomain {
+		return "registry-1.docker.io"
+	}
+	return domain
+}
+
+// normalizeDomain turns the keys used in docker config files, like
+// https://index.docker.io/v1/, into a bare registry domain.
+func normalizeDomain(domain string) string {
+	if i := strings.Index(domain, "://"); i >= 0 {
+		domain = domain[i+3:]
+	}
+	if i := strings.Index(domain, "/"); i >= 0 {
+		domain = domain[:i]
+	}
+	switch domain {
+	case "index.docker.io", "registry-1.docker.io":
+		return defaultDomain
+	}
+	return domain
+}
+
+// parseChallenge splits `Bearer realm="...",service="..."` into the scheme and
+// its parameters.
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := map[string]string{}
+	challenge = strings.TrimSpace(challenge)
+	i := strings.Index(challenge, " ")
+	if i < 0 {
+		return challenge, params
+	}
+	scheme, rest := challenge[:i], challenge[i+1:]
+
+	for rest != "" {
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = strings.TrimSpace(rest[eq+1:])
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if comma := strings.Index(rest, ","); comma >= 0 {
+			value, rest = rest[:comma], rest[comma:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[key] = value
+		rest = strings.TrimLeft(rest, ", ")
+	}
+	return scheme, params
+}
+
+func basicAuth(cred Credential) string {
+	return base64.StdEncoding.EncodeToString([]byte(cred.Username + ":" + cred.Password))
+}
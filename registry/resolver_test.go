@@ -0,0 +1,142 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testDigest = "sha256:4a5b8c1e9f0d2c3b4a5b8c1e9f0d2c3b4a5b8c1e9f0d2c3b4a5b8c1e9f0d2c3b"
+
+// fakeRegistry serves team/app:v1 behind a bearer token that needs the
+// login user:pass, and team/plain:latest without the digest header.
+func fakeRegistry(t *testing.T) (*httptest.Server, *int) {
+	requests := 0
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/token":
+			if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "pass" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if got := r.URL.Query().Get("scope"); got != "repository:team/app:pull" {
+				t.Errorf("token scope %q", got)
+			}
+			fmt.Fprint(w, `{"token":"secret-token"}`)
+		case "/v2/team/app/manifests/v1":
+			if r.Header.Get("Authorization") != "Bearer secret-token" {
+				w.Header().Set("Www-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry"`, srv.URL))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if !strings.Contains(r.Header.Get("Accept"), "manifest.list.v2+json") {
+				t.Errorf("accept %q", r.Header.Get("Accept"))
+			}
+			w.Header().Set("Docker-Content-Digest", testDigest)
+		case "/v2/team/plain/manifests/latest":
+			if r.Method == http.MethodGet {
+				fmt.Fprint(w, `{"schemaVersion":2}`)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return srv, &requests
+}
+
+func TestResolve(t *testing.T) {
+	srv, requests := fakeRegistry(t)
+	defer srv.Close()
+	domain := strings.TrimPrefix(srv.URL, "http://")
+
+	r := NewResolver(true)
+	r.SetCredential(domain, Credential{Username: "user", Password: "pass"})
+
+	got, err := r.Resolve(domain + "/team/app:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := domain + "/team/app@" + testDigest; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	got, err = r.Resolve(domain + "/team/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("%s/team/plain@sha256:%x", domain, sha256.Sum256([]byte(`{"schemaVersion":2}`))); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	// resolved tags are cached, digests are left alone
+	before := *requests
+	if _, err = r.Resolve(domain + "/team/app:v1"); err != nil {
+		t.Fatal(err)
+	}
+	pinned := domain + "/team/app@" + testDigest
+	if got, err = r.Resolve(pinned); err != nil || got != pinned {
+		t.Errorf("got %s, %v, want %s", got, err, pinned)
+	}
+	if *requests != before {
+		t.Errorf("expected no requests, got %d", *requests-before)
+	}
+
+	if _, err = r.Resolve(domain + "/team/missing:v1"); err == nil {
+		t.Error("expected an error for a missing tag")
+	}
+}
+
+func TestResolveWithoutCredentials(t *testing.T) {
+	srv, _ := fakeRegistry(t)
+	defer srv.Close()
+	domain := strings.TrimPrefix(srv.URL, "http://")
+
+	if _, err := NewResolver(true).Resolve(domain + "/team/app:v1"); err == nil {
+		t.Error("expected an error without credentials")
+	}
+}
+
+func TestAddDockerConfig(t *testing.T) {
+	r := NewResolver(false)
+	err := r.AddDockerConfig([]byte(`{"auths":{"https://index.docker.io/v1/":{"auth":"dXNlcjpwYXNz"},"ccr.ccs.tencentyun.com":{"username":"u","password":"p"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred, ok := r.credential("docker.io"); !ok || cred != (Credential{"user", "pass"}) {
+		t.Errorf("docker.io: got %+v", cred)
+	}
+	if cred, ok := r.credential("ccr.ccs.tencentyun.com"); !ok || cred != (Credential{"u", "p"}) {
+		t.Errorf("ccr.ccs.tencentyun.com: got %+v", cred)
+	}
+	if _, ok := r.credential("quay.io"); ok {
+		t.Error("quay.io: expected no credential")
+	}
+}
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		image string
+		want  Reference
+	}{
+		{"nginx", Reference{Domain: "docker.io", Path: "library/nginx", Tag: "latest"}},
+		{"team/app:1.2", Reference{Domain: "docker.io", Path: "team/app", Tag: "1.2"}},
+		{"localhost:5000/app", Reference{Domain: "localhost:5000", Path: "app", Tag: "latest"}},
+		{"ccr.ccs.tencentyun.com/team/app:v1", Reference{Domain: "ccr.ccs.tencentyun.com", Path: "team/app", Tag: "v1"}},
+		{"app@" + testDigest, Reference{Domain: "docker.io", Path: "library/app", Digest: testDigest}},
+	}
+	for _, test := range tests {
+		ref, err := ParseReference(test.image)
+		if err != nil {
+			t.Errorf("%s: %v", test.image, err)
+			continue
+		}
+		if *ref != test.want {
+			t.Errorf("%s: got %+v, want %+v", test.image, *ref, test.want)
+		}
+	}
+}
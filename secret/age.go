@@ -0,0 +1,284 @@
+package secret
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// a minimal reader for the age v1 format (https://age-encryption.org/v1),
+// limited to X25519 recipients, which is what sops and the age cli use.
+
+const (
+	ageIntro     = "age-encryption.org/v1\n"
+	ageArmorHead = "-----BEGIN AGE ENCRYPTED FILE-----"
+	ageArmorTail = "-----END AGE ENCRYPTED FILE-----"
+	ageChunkSize = 64 * 1024
+)
+
+type ageIdentity struct {
+	secret    [32]byte
+	recipient [32]byte
+}
+
+// parseAgeIdentity parses an AGE-SECRET-KEY-1... line.
+func parseAgeIdentity(s string) (*ageIdentity, error) {
+	hrp, data, err := bech32Decode(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed age secret key")
+	}
+	if hrp != "age-secret-key-" || len(data) != 32 {
+		return nil, errors.New("malformed age secret key")
+	}
+	id := &ageIdentity{}
+	copy(id.secret[:], data)
+	curve25519.ScalarBaseMult(&id.recipient, &id.secret)
+	return id, nil
+}
+
+type ageStanza struct {
+	args []string
+	body []byte
+}
+
+// ageDecrypt decrypts an age file, armored or not, with the first identity
+// one of its X25519 stanzas is addressed to.
+func ageDecrypt(file []byte, identities []*ageIdentity) ([]byte, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(file), []byte(ageArmorHead)) {
+		var err error
+		if file, err = ageDearmor(file); err != nil {
+			return nil, err
+		}
+	}
+	if !bytes.HasPrefix(file, []byte(ageIntro)) {
+		return nil, errors.New("not an age v1 file")
+	}
+
+	stanzas, header, mac, payload, err := ageParseHeader(file)
+	if err != nil {
+		return nil, err
+	}
+	var fileKey []byte
+	for _, s := range stanzas {
+		if len(s.args) != 2 || s.args[0] != "X25519" {
+			continue
+		}
+		for _, id := range identities {
+			if fileKey, err = id.unwrap(s); err == nil {
+				break
+			}
+		}
+		if fileKey != nil {
+			break
+		}
+	}
+	if fileKey == nil {
+		return nil, errors.New("no age identity matches any recipient")
+	}
+
+	h := hmac.New(sha256.New, ageKey(fileKey, nil, "header", 32))
+	h.Write(header)
+	if !hmac.Equal(h.Sum(nil), mac) {
+		return nil, errors.New("age header mac mismatch")
+	}
+
+	if len(payload) < 16 {
+		return nil, errors.New("age payload is truncated")
+	}
+	return ageOpenStream(ageKey(fileKey, payload[:16], "payload", chacha20poly1305.KeySize), payload[16:])
+}
+
+func (id *ageIdentity) unwrap(s ageStanza) ([]byte, error) {
+	share, err := base64.RawStdEncoding.DecodeString(s.args[1])
+	if err != nil || len(share) != 32 {
+		return nil, errors.New("invalid X25519 stanza")
+	}
+	var theirs, shared [32]byte
+	copy(theirs[:], share)
+	curve25519.ScalarMult(&shared, &id.secret, &theirs)
+	if shared == [32]byte{} {
+		return nil, errors.New("invalid X25519 share")
+	}
+	salt := append(append([]byte{}, share...), id.recipient[:]...)
+	aead, err := chacha20poly1305.New(ageKey(shared[:], salt, "age-encryption.org/v1/X25519", chacha20poly1305.KeySize))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return aead.Open(nil, make([]byte, chacha20poly1305.NonceSize), s.body, nil)
+}
+
+// ageParseHeader splits the file into its stanzas, the header text the mac
+// is computed over, the mac and the payload.
+func ageParseHeader(file []byte) ([]ageStanza, []byte, []byte, []byte, error) {
+	var stanzas []ageStanza
+	rest := file[len(ageIntro):]
+	line := func() (string, error) {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			return "", errors.New("age header is truncated")
+		}
+		l := string(rest[:i])
+		rest = rest[i+1:]
+		return l, nil
+	}
+	for {
+		l, err := line()
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		if strings.HasPrefix(l, "--- ") {
+			mac, err := base64.RawStdEncoding.DecodeString(l[4:])
+			if err != nil {
+				return nil, nil, nil, nil, errors.New("invalid age header mac")
+			}
+			// the mac covers the header up to and including the ---
+			start := len(file) - len(rest) - len(l) - 1
+			header := file[:start+3]
+			return stanzas, header, mac, rest, nil
+		}
+		if !strings.HasPrefix(l, "-> ") {
+			return nil, nil, nil, nil, errors.New("invalid age header")
+		}
+		s := ageStanza{args: strings.Fields(l[3:])}
+		for {
+			b, err := line()
+			if err != nil {
+				return nil, nil, nil, nil, err
+			}
+			chunk, err := base64.RawStdEncoding.DecodeString(b)
+			if err != nil {
+				return nil, nil, nil, nil, errors.New("invalid age stanza body")
+			}
+			s.body = append(s.body, chunk...)
+			if len(b) < 64 {
+				break
+			}
+		}
+		stanzas = append(stanzas, s)
+	}
+}
+
+func ageOpenStream(key, data []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var out []byte
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	for counter := uint64(0); ; counter++ {
+		n := ageChunkSize + aead.Overhead()
+		last := len(data) <= n
+		if last {
+			n = len(data)
+		}
+		binary.BigEndian.PutUint64(nonce[3:11], counter)
+		if last {
+			nonce[11] = 1
+		}
+		chunk, err := aead.Open(nil, nonce, data[:n], nil)
+		if err != nil {
+			return nil, errors.New("age payload is corrupted")
+		}
+		out = append(out, chunk...)
+		data = data[n:]
+		if last {
+			return out, nil
+		}
+	}
+}
+
+func ageDearmor(file []byte) ([]byte, error) {
+	text := strings.TrimSpace(string(file))
+	if !strings.HasSuffix(text, ageArmorTail) {
+		return nil, errors.New("age armor is truncated")
+	}
+	text = strings.TrimSuffix(strings.TrimPrefix(text, ageArmorHead), ageArmorTail)
+	out, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+	if err != nil {
+		return nil, errors.New("invalid age armor")
+	}
+	return out, nil
+}
+
+func ageKey(secret, salt []byte, info string, size int) []byte {
+	key := make([]byte, size)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(info)), key); err != nil {
+		panic(err)
+	}
+	return key
+}
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// bech32Decode returns the lowercase human readable part and the data of a
+// bech32 string, without the length limit age keys exceed.
+func bech32Decode(s string) (string, []byte, error) {
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, errors.New("mixed case")
+	}
+	s = strings.ToLower(s)
+	pos := strings.LastIndexByte(s, '1')
+	if pos < 1 || pos+7 > len(s) {
+		return "", nil, errors.New("invalid separator")
+	}
+	hrp := s[:pos]
+	var values []byte
+	for _, c := range s[pos+1:] {
+		v := strings.IndexRune(bech32Charset, c)
+		if v < 0 {
+			return "", nil, errors.New("invalid character")
+		}
+		values = append(values, byte(v))
+	}
+	check := make([]byte, 0, len(hrp)*2+1+len(values))
+	for _, c := range hrp {
+		check = append(check, byte(c>>5))
+	}
+	check = append(check, 0)
+	for _, c := range hrp {
+		check = append(check, byte(c&31))
+	}
+	if bech32Polymod(append(check, values...)) != 1 {
+		return "", nil, errors.New("invalid checksum")
+	}
+
+	// regroup the 5 bit values, without the checksum, into bytes
+	var out []byte
+	acc, bits := 0, uint(0)
+	for _, v := range values[:len(values)-6] {
+		acc = (acc<<5 | int(v)) & 0xfff
+		bits += 5
+		for bits >= 8 {
+			bits -= 8
+			out = append(out, byte(acc>>bits))
+		}
+	}
+	if bits >= 5 || acc&(1<<bits-1) != 0 {
+		return "", nil, errors.New("invalid padding")
+	}
+	return hrp, out, nil
+}
+
+func bech32Polymod(values []byte) uint32 {
+	gen := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
@@ -0,0 +1,48 @@
+package secret
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAgeDecrypt(t *testing.T) {
+	message := readFixture(t, "message.age")
+	if !IsEncrypted(message) {
+		t.Fatal("expected the age message to be recognized")
+	}
+	plain, err := testKeyring(t, "age.key").Decrypt(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plain) != testMessage {
+		t.Errorf("got %q, want %q", plain, testMessage)
+	}
+}
+
+func TestAgeDecryptWrongKey(t *testing.T) {
+	if _, err := testKeyring(t, "other.key").Decrypt(readFixture(t, "message.age")); err == nil {
+		t.Error("expected an error with a key that is not a recipient")
+	}
+}
+
+func TestAgeDecryptTampered(t *testing.T) {
+	file, err := ageDearmor([]byte(readFixture(t, "message.age")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := testKeyring(t, "age.key")
+	mac := bytes.Index(file, []byte("\n--- ")) + len("\n--- ")
+
+	tests := map[string]func(b []byte) []byte{
+		// the first character of the mac, a full six bits of it
+		"header mac": func(b []byte) []byte { b[mac] ^= 'A' ^ 'B'; return b },
+		"payload":    func(b []byte) []byte { b[len(b)-1] ^= 1; return b },
+		"truncated":  func(b []byte) []byte { return b[:len(b)-8] },
+	}
+	for name, tamper := range tests {
+		b := tamper(append([]byte{}, file...))
+		if _, err := ageDecrypt(b, k.age); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
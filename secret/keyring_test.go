@@ -0,0 +1,65 @@
+package secret
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// the fixtures in testdata were made with age-keygen, age -a, gpg and sops;
+// message.age and message.asc both hold hunter2-password.
+const testMessage = "hunter2-password"
+
+func readFixture(t *testing.T, name string) string {
+	t.Helper()
+	b, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func testKeyring(t *testing.T, name string) *Keyring {
+	t.Helper()
+	k, err := ParseKeyring(readFixture(t, name), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestDecryptPGP(t *testing.T) {
+	message := readFixture(t, "message.asc")
+	if !IsEncrypted(message) {
+		t.Fatal("expected the PGP message to be recognized")
+	}
+	plain, err := testKeyring(t, "pgp.key").Decrypt(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plain) != testMessage {
+		t.Errorf("got %q, want %q", plain, testMessage)
+	}
+
+	if _, err = testKeyring(t, "age.key").Decrypt(message); err == nil {
+		t.Error("expected an error without a PGP key")
+	}
+}
+
+func TestParseKeyringErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"AGE-SECRET-KEY-1NOTAKEY",
+		pgpKeyHead + "\nxx",
+	}
+	for _, key := range tests {
+		if _, err := ParseKeyring(key, ""); err == nil {
+			t.Errorf("%q: expected an error", key)
+		}
+	}
+
+	var k *Keyring
+	if _, err := k.Decrypt(readFixture(t, "message.age")); err == nil {
+		t.Error("expected an error without a keyring")
+	}
+}
@@ -0,0 +1,377 @@
+package secret
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goerzh/drone-kube/util"
+	"github.com/pkg/errors"
+	yamlv2 "gopkg.in/yaml.v2"
+	"sigs.k8s.io/yaml"
+)
+
+// values sops encrypted, e.g. ENC[AES256_GCM,data:...,iv:...,tag:...,type:str]
+var encPattern = regexp.MustCompile(`^ENC\[AES256_GCM,data:(.*),iv:(.+),tag:(.+),type:(.+)\]$`)
+
+// a sops document has its metadata under a top level sops key
+var sopsPattern = regexp.MustCompile(`(?m)^sops:`)
+
+type sopsMetadata struct {
+	LastModified string `json:"lastmodified"`
+	MAC          string `json:"mac"`
+	Age          []struct {
+		Enc string `json:"enc"`
+	} `json:"age"`
+	PGP []struct {
+		Enc string `json:"enc"`
+	} `json:"pgp"`
+}
+
+// Verify checks the integrity of every sops document of a yaml file, the way
+// sops does when decrypting. The mac covers the values in the order they
+// are written, so this has to run on the file as committed, before any
+// templating; the values are only decrypted later on, by DecryptObject.
+func (k *Keyring) Verify(file []byte) error {
+	_, err := k.verify(file)
+	return err
+}
+
+// VerifyBuild checks the sops documents of the output of a build that
+// reorders them, like kustomize, where their mac cannot be checked anymore:
+// the macs are checked on the source files, and every sops document of the
+// output must be one of theirs.
+func (k *Keyring) VerifyBuild(sources []string, out []byte) error {
+	if !sopsPattern.Match(out) {
+		return nil
+	}
+	verified := map[string]bool{}
+	for _, name := range sources {
+		file, err := ioutil.ReadFile(name)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		macs, err := k.verify(file)
+		if err != nil {
+			return errors.Wrapf(err, "cannot verify %s", name)
+		}
+		for _, mac := range macs {
+			verified[mac] = true
+		}
+	}
+
+	dec := yamlv2.NewDecoder(bytes.NewReader(out))
+	for {
+		var doc struct{ Sops *sopsMetadata }
+		if err := dec.Decode(&doc); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return errors.WithStack(err)
+		}
+		if doc.Sops != nil && !verified[doc.Sops.MAC] {
+			return errors.New("sops document does not come from a local source file, its mac cannot be checked")
+		}
+	}
+}
+
+// verify returns the macs of the sops documents of file once checked.
+func (k *Keyring) verify(file []byte) ([]string, error) {
+	if !sopsPattern.Match(file) {
+		return nil, nil
+	}
+	var macs []string
+	dec := yamlv2.NewDecoder(bytes.NewReader(file))
+	for {
+		var doc yamlv2.MapSlice
+		if err := dec.Decode(&doc); err != nil {
+			if err == io.EOF {
+				return macs, nil
+			}
+			return nil, errors.Wrap(err, "sops documents must be valid yaml before templating")
+		}
+		var meta *sopsMetadata
+		for _, item := range doc {
+			if item.Key != "sops" {
+				continue
+			}
+			raw, err := yamlv2.Marshal(item.Value)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			meta = &sopsMetadata{}
+			if err = yaml.Unmarshal(raw, meta); err != nil {
+				return nil, errors.Wrap(err, "invalid sops metadata")
+			}
+		}
+		if meta == nil {
+			continue
+		}
+
+		key, err := k.dataKey(meta)
+		if err != nil {
+			return nil, err
+		}
+		h := sha512.New()
+		for _, item := range doc {
+			if item.Key == "sops" {
+				continue
+			}
+			if err = macWalk(h, item.Value, []string{fmt.Sprint(item.Key)}, key); err != nil {
+				return nil, err
+			}
+		}
+		modified, err := time.Parse(time.RFC3339, meta.LastModified)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid sops lastmodified")
+		}
+		mac, err := decryptValue(meta.MAC, key, modified.Format(time.RFC3339))
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot decrypt sops mac")
+		}
+		if mac != fmt.Sprintf("%X", h.Sum(nil)) {
+			return nil, errors.New("sops mac mismatch, the document was changed after it was encrypted")
+		}
+		macs = append(macs, meta.MAC)
+	}
+}
+
+// macWalk hashes the plain values of a tree like sops does.
+func macWalk(h hash.Hash, v interface{}, path []string, key []byte) error {
+	switch v := v.(type) {
+	case yamlv2.MapSlice:
+		for _, item := range v {
+			if err := macWalk(h, item.Value, append(path[:len(path):len(path)], fmt.Sprint(item.Key)), key); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		for _, item := range v {
+			if err := macWalk(h, item, path, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	case nil:
+		return nil
+	case string:
+		if encPattern.MatchString(v) {
+			plain, err := decryptValue(v, key, strings.Join(path, ":")+":")
+			if err != nil {
+				return errors.Wrapf(err, "cannot decrypt %s", strings.Join(path, "."))
+			}
+			h.Write([]byte(sopsString(plain)))
+			return nil
+		}
+	}
+	h.Write([]byte(sopsString(v)))
+	return nil
+}
+
+// sopsString formats a value the way sops writes it into the mac.
+func sopsString(v interface{}) string {
+	switch v := v.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "True"
+		}
+		return "False"
+	}
+	return fmt.Sprint(v)
+}
+
+// IsSOPS tells whether a decoded object is a sops document.
+func IsSOPS(obj map[string]interface{}) bool {
+	_, ok := obj["sops"].(map[string]interface{})
+	return ok
+}
+
+// DecryptObject decrypts a decoded object in place: the values of a sops
+// document, whose metadata is then removed, and any string that is an
+// armored age or PGP message. Every decrypted value is masked in the output,
+// whatever the kind of the object.
+func (k *Keyring) DecryptObject(obj map[string]interface{}) error {
+	if IsSOPS(obj) {
+		raw, err := json.Marshal(obj["sops"])
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		meta := &sopsMetadata{}
+		if err = json.Unmarshal(raw, meta); err != nil {
+			return errors.Wrap(err, "invalid sops metadata")
+		}
+		key, err := k.dataKey(meta)
+		if err != nil {
+			return err
+		}
+		delete(obj, "sops")
+		for name, v := range obj {
+			if obj[name], err = sopsDecrypt(v, []string{name}, key); err != nil {
+				return err
+			}
+		}
+	}
+
+	var err error
+	for name, v := range obj {
+		if obj[name], err = k.decryptMessages(v); err != nil {
+			return errors.Wrapf(err, "cannot decrypt %s", name)
+		}
+	}
+	return nil
+}
+
+func sopsDecrypt(v interface{}, path []string, key []byte) (interface{}, error) {
+	var err error
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for name, item := range v {
+			if v[name], err = sopsDecrypt(item, append(path[:len(path):len(path)], name), key); err != nil {
+				return nil, err
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			if v[i], err = sopsDecrypt(item, path, key); err != nil {
+				return nil, err
+			}
+		}
+	case string:
+		if !encPattern.MatchString(v) {
+			return v, nil
+		}
+		plain, err := decryptValue(v, key, strings.Join(path, ":")+":")
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot decrypt %s", strings.Join(path, "."))
+		}
+		util.Sensitive(sopsString(plain))
+		// unstructured objects hold int64, not int
+		if i, ok := plain.(int); ok {
+			return int64(i), nil
+		}
+		return plain, nil
+	}
+	return v, nil
+}
+
+func (k *Keyring) decryptMessages(v interface{}) (interface{}, error) {
+	var err error
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for name, item := range v {
+			if v[name], err = k.decryptMessages(item); err != nil {
+				return nil, err
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			if v[i], err = k.decryptMessages(item); err != nil {
+				return nil, err
+			}
+		}
+	case string:
+		if IsEncrypted(v) {
+			plain, err := k.Decrypt(v)
+			if err != nil {
+				return nil, err
+			}
+			util.Sensitive(string(plain))
+			return string(plain), nil
+		}
+	}
+	return v, nil
+}
+
+// dataKey decrypts the key the values of a sops document are encrypted with,
+// using whichever of its age or PGP recipients there is a private key for.
+func (k *Keyring) dataKey(meta *sopsMetadata) ([]byte, error) {
+	if k == nil {
+		return nil, errors.New("document is encrypted with sops but no decryption key is set")
+	}
+	if key, ok := k.dataKeys[meta.MAC]; ok {
+		return key, nil
+	}
+	var encrypted []string
+	if len(k.age) > 0 {
+		for _, r := range meta.Age {
+			encrypted = append(encrypted, r.Enc)
+		}
+	}
+	if len(k.pgp) > 0 {
+		for _, r := range meta.PGP {
+			encrypted = append(encrypted, r.Enc)
+		}
+	}
+	for _, enc := range encrypted {
+		if key, err := k.Decrypt(enc); err == nil {
+			k.dataKeys[meta.MAC] = key
+			return key, nil
+		}
+	}
+	return nil, errors.New("none of the decryption keys is a recipient of the sops document")
+}
+
+// decryptValue decrypts a single sops value, authenticated with the path
+// of its key as additional data. Errors never contain the value.
+func decryptValue(value string, key []byte, additional string) (interface{}, error) {
+	m := encPattern.FindStringSubmatch(value)
+	if m == nil {
+		return nil, errors.New("not a sops value")
+	}
+	var parts [3][]byte
+	for i := range parts {
+		var err error
+		if parts[i], err = base64.StdEncoding.DecodeString(m[i+1]); err != nil {
+			return nil, errors.New("malformed sops value")
+		}
+	}
+	data, iv, tag := parts[0], parts[1], parts[2]
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	plain, err := gcm.Open(nil, iv, append(data, tag...), []byte(additional))
+	if err != nil {
+		return nil, errors.New("sops value does not authenticate")
+	}
+
+	s := string(plain)
+	switch m[4] {
+	case "str", "bytes", "comment":
+		return s, nil
+	case "int":
+		if i, err := strconv.Atoi(s); err == nil {
+			return i, nil
+		}
+	case "float":
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f, nil
+		}
+	case "bool":
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b, nil
+		}
+	default:
+		return nil, errors.Errorf("unknown sops value type %q", m[4])
+	}
+	return nil, errors.Errorf("sops value is not a valid %s", m[4])
+}
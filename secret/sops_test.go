@@ -0,0 +1,129 @@
+package secret
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/goerzh/drone-kube/util"
+	"sigs.k8s.io/yaml"
+)
+
+func TestSOPSDecrypt(t *testing.T) {
+	file := readFixture(t, "secret.enc.yaml")
+	k := testKeyring(t, "age.key")
+	if err := k.Verify([]byte(file)); err != nil {
+		t.Fatal(err)
+	}
+
+	obj := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(file), &obj); err != nil {
+		t.Fatal(err)
+	}
+	if !IsSOPS(obj) {
+		t.Fatal("expected a sops document")
+	}
+	if err := k.DecryptObject(obj); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": "db"},
+		"stringData": map[string]interface{}{
+			"password":          "s3cr3t-pass",
+			"port":              int64(5432),
+			"hosts":             []interface{}{"db-0.internal", "db-1.internal"},
+			"plain_unencrypted": "visible",
+		},
+	}
+	if !reflect.DeepEqual(obj, want) {
+		t.Errorf("got %#v, want %#v", obj, want)
+	}
+	if out := util.Redact("password s3cr3t-pass on db-1.internal"); strings.Contains(out, "s3cr3t-pass") || strings.Contains(out, "db-1.internal") {
+		t.Errorf("expected the decrypted values to be masked, got %q", out)
+	}
+}
+
+func TestSOPSVerifyTampered(t *testing.T) {
+	file := readFixture(t, "secret.enc.yaml")
+	hosts := strings.SplitAfter(file, "hosts:\n")[1]
+	lines := strings.SplitN(hosts, "\n", 3)
+
+	tests := map[string]string{
+		// metadata.name is not encrypted but still covered by the mac
+		"plain value": strings.Replace(file, "name: db", "name: dc", 1),
+		// both hosts decrypt fine on their own, the order is what changed
+		"swapped values": strings.Replace(file, lines[0]+"\n"+lines[1], lines[1]+"\n"+lines[0], 1),
+		"mac":            strings.Replace(file, "mac: ENC[AES256_GCM,data:w", "mac: ENC[AES256_GCM,data:x", 1),
+	}
+	for name, tampered := range tests {
+		if tampered == file {
+			t.Fatalf("%s: the fixture was not changed", name)
+		}
+		if err := testKeyring(t, "age.key").Verify([]byte(tampered)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestSOPSDecryptMovedValue(t *testing.T) {
+	file := readFixture(t, "secret.enc.yaml")
+	obj := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(file), &obj); err != nil {
+		t.Fatal(err)
+	}
+	// values are bound to their path, one cannot be moved to another key
+	data := obj["stringData"].(map[string]interface{})
+	data["password"] = data["plain_unencrypted"]
+	if err := testKeyring(t, "age.key").DecryptObject(obj); err == nil {
+		t.Error("expected an error for a value moved to another key")
+	}
+}
+
+func TestSOPSDecryptWrongKey(t *testing.T) {
+	file := readFixture(t, "secret.enc.yaml")
+	k := testKeyring(t, "other.key")
+	if err := k.Verify([]byte(file)); err == nil {
+		t.Error("expected Verify to fail with a key that is not a recipient")
+	}
+	obj := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(file), &obj); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.DecryptObject(obj); err == nil {
+		t.Error("expected DecryptObject to fail with a key that is not a recipient")
+	}
+}
+
+func TestSOPSVerifyBuild(t *testing.T) {
+	source := filepath.Join("testdata", "secret.enc.yaml")
+	file := readFixture(t, "secret.enc.yaml")
+	// a build writes the documents back with their keys sorted
+	obj := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(file), &obj); err != nil {
+		t.Fatal(err)
+	}
+	out, err := yaml.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := testKeyring(t, "age.key")
+
+	if err := k.VerifyBuild([]string{source}, out); err != nil {
+		t.Errorf("verified source: %v", err)
+	}
+	if err := k.VerifyBuild(nil, out); err == nil {
+		t.Error("expected an error for a document without a local source")
+	}
+
+	tampered := filepath.Join(t.TempDir(), "secret.enc.yaml")
+	if err := ioutil.WriteFile(tampered, []byte(strings.Replace(file, "name: db", "name: dc", 1)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.VerifyBuild([]string{tampered}, out); err == nil || !strings.Contains(err.Error(), "mac mismatch") {
+		t.Errorf("expected a mac mismatch for a tampered source, got %v", err)
+	}
+}
@@ -1,11 +1,116 @@
 package util
 
+import "time"
+
+// Cluster is one target of a multi-cluster deploy. Empty fields fall back to
+// the top level settings.
+type Cluster struct {
+	Name      string                 `json:"name"`
+	Server    string                 `json:"server"`
+	Token     string                 `json:"token"`
+	Ca        string                 `json:"ca"`
+	Namespace string                 `json:"namespace"`
+	Values    map[string]interface{} `json:"values"`
+}
+
 type Config struct {
+	Action    string
 	Ca        string
 	Server    string
 	Token     string
 	Namespace string
-	Template  string
+	Template  []string
 	Ingress   string
 	Service   string
+	Kustomize string
+	Partials  string
+
+	// private keys for the sops documents and encrypted values
+	DecryptionKey        string
+	DecryptionPassphrase string
+
+	// how remote templates are fetched
+	TemplateToken    string
+	TemplateUsername string
+	TemplatePassword string
+	TemplateTimeout  time.Duration
+	TemplateRetries  int
+
+	// git repository holding the templates
+	TemplateRepo           string
+	TemplateRef            string
+	TemplatePath           string
+	TemplateRepoSSHKey     string
+	TemplateRepoKnownHosts string
+	TemplateRepoUsername   string
+	TemplateRepoToken      string
+
+	// resolve image tags to digests before applying
+	PinDigests       bool
+	Registry         string
+	RegistryUsername string
+	RegistryPassword string
+	RegistryInsecure bool
+
+	// rules the rendered objects have to satisfy
+	Policy           []string
+	PolicyRegistries []string
+	PolicyRules      []string
+	PolicyWarn       bool
+
+	// deployments to restart, and whether to wait for their rollout
+	Restart    []string
+	ConfigHash bool
+	Provenance bool
+	Events     bool
+	Wait       bool
+	WaitFor    []string
+	Timeout    time.Duration
+
+	// retries of api calls failing for a reason that may go away
+	RetryAttempts int
+	RetryDeadline time.Duration
+
+	// targets of the actions other than apply
+	Deployments []string
+	Replicas    int32
+	ReplicasSet bool
+	Propagation string
+
+	// defaults for the namespace when it has to be created
+	CreateNamespace      bool
+	NamespaceLabels      map[string]string
+	NamespaceAnnotations map[string]string
+	NamespaceQuota       map[string]string
+	NamespaceLimits      map[string]string
+	NamespaceRequests    map[string]string
+
+	// webhooks told about the start and outcome of a run
+	NotifyWebhook  []string
+	NotifyTemplate string
+	NotifyOn       []string
+	NotifyHeaders  map[string]string
+	NotifyRetries  int
+
+	// http check after the deploy
+	SmokeTest         string
+	SmokeTestStatus   int
+	SmokeTestBody     string
+	SmokeTestRetries  int
+	SmokeTestInterval time.Duration
+	SmokeTestRollback bool
+
+	// json summary of the run
+	ReportFile string
+
+	// deploy metrics, pushed or written as OpenMetrics
+	MetricsPushgateway string
+	MetricsJob         string
+	MetricsFile        string
+	MetricsEnvironment string
+
+	// fan out to several clusters
+	Clusters    []Cluster
+	Parallelism int
+	OnFailure   string
 }
@@ -0,0 +1,143 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Fetcher reads templates from local files or urls. Remote templates can be
+// pinned by appending the expected checksum to the url as a fragment:
+// https://example.com/deployment.yaml#sha256=<hex digest>
+type Fetcher struct {
+	Client   *http.Client
+	Token    string
+	Username string
+	Password string
+	Retries  int
+}
+
+// DefaultFetcher reads the templates given to Render and OpenAndSub. The
+// plugin replaces it with one made from its settings, so these get the
+// template credentials too.
+var DefaultFetcher = &Fetcher{
+	Client:  &http.Client{Timeout: 30 * time.Second},
+	Retries: 2,
+}
+
+func NewFetcher(cfg Config) *Fetcher {
+	timeout := cfg.TemplateTimeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	return &Fetcher{
+		Client:   &http.Client{Timeout: timeout},
+		Token:    cfg.TemplateToken,
+		Username: cfg.TemplateUsername,
+		Password: cfg.TemplatePassword,
+		Retries:  cfg.TemplateRetries,
+	}
+}
+
+// IsURL tells whether a template setting refers to a url rather than a path.
+func IsURL(name string) bool {
+	u, err := url.Parse(name)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "http", "https", "file":
+		return true
+	}
+	return false
+}
+
+// Read returns the content of a local file or url, after checking it against
+// the sha256 pin of the url if there is one.
+func (f *Fetcher) Read(name string) ([]byte, error) {
+	if !IsURL(name) {
+		return ioutil.ReadFile(name)
+	}
+
+	u, err := url.Parse(name)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	pin := ""
+	if strings.HasPrefix(u.Fragment, "sha256=") {
+		pin = strings.ToLower(strings.TrimPrefix(u.Fragment, "sha256="))
+	}
+	u.Fragment = ""
+
+	var out []byte
+	if u.Scheme == "file" {
+		out, err = ioutil.ReadFile(u.Path)
+	} else {
+		out, err = f.fetch(u.String())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if pin != "" {
+		sum := sha256.Sum256(out)
+		if got := hex.EncodeToString(sum[:]); got != pin {
+			return nil, errors.Errorf("checksum mismatch for %s: expected sha256 %s, got %s", u, pin, got)
+		}
+	}
+	return out, nil
+}
+
+// fetch downloads a url, retrying with a growing delay on connection errors,
+// throttling and server errors.
+func (f *Fetcher) fetch(endpoint string) ([]byte, error) {
+	var lastErr error
+	for attempt := 0; attempt <= f.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(1<<uint(attempt-1)) * time.Second)
+		}
+
+		req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if f.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+f.Token)
+		} else if f.Username != "" {
+			req.SetBasicAuth(f.Username, f.Password)
+		}
+
+		res, err := f.Client.Do(req)
+		if err != nil {
+			lastErr = errors.WithStack(err)
+			continue
+		}
+		out, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			lastErr = errors.WithStack(err)
+			continue
+		}
+
+		switch {
+		case res.StatusCode == http.StatusOK:
+			return out, nil
+		case retryable(res.StatusCode):
+			lastErr = errors.Errorf("GET %s: %s", endpoint, res.Status)
+		default:
+			return nil, errors.Errorf("GET %s: %s", endpoint, res.Status)
+		}
+	}
+	return nil, lastErr
+}
+
+// throttling and server errors may go away when trying again
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
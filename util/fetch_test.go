@@ -0,0 +1,111 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const fetchBody = "kind: Service\n"
+
+// fetchServer answers with the given statuses in turn, then with fetchBody.
+func fetchServer(t *testing.T, statuses ...int) (*httptest.Server, *[]*http.Request) {
+	var requests []*http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		if len(requests) <= len(statuses) {
+			w.WriteHeader(statuses[len(requests)-1])
+			return
+		}
+		w.Write([]byte(fetchBody))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func testFetcher() *Fetcher {
+	return &Fetcher{Client: &http.Client{Timeout: 5 * time.Second}, Retries: 1}
+}
+
+func TestFetcherPin(t *testing.T) {
+	srv, _ := fetchServer(t)
+	sum := sha256.Sum256([]byte(fetchBody))
+	digest := hex.EncodeToString(sum[:])
+
+	out, err := testFetcher().Read(srv.URL + "/service.yaml#sha256=" + strings.ToUpper(digest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != fetchBody {
+		t.Errorf("got %q", out)
+	}
+
+	_, err = testFetcher().Read(srv.URL + "/service.yaml#sha256=" + strings.Repeat("0", 64))
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected a checksum mismatch, got %v", err)
+	}
+}
+
+func TestFetcherRetries(t *testing.T) {
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusBadGateway} {
+		srv, requests := fetchServer(t, status)
+		out, err := testFetcher().Read(srv.URL)
+		if err != nil {
+			t.Fatalf("%d: %v", status, err)
+		}
+		if string(out) != fetchBody || len(*requests) != 2 {
+			t.Errorf("%d: got %q after %d requests", status, out, len(*requests))
+		}
+	}
+}
+
+func TestFetcherClientErrorNotRetried(t *testing.T) {
+	srv, requests := fetchServer(t, http.StatusNotFound)
+	_, err := testFetcher().Read(srv.URL)
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected a 404, got %v", err)
+	}
+	if len(*requests) != 1 {
+		t.Errorf("%d requests, a 404 is not retried", len(*requests))
+	}
+}
+
+func TestFetcherAuth(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{"bearer", Config{TemplateToken: "t0ken", TemplateUsername: "ci", TemplatePassword: "pw"}, "Bearer t0ken"},
+		{"basic", Config{TemplateUsername: "ci", TemplatePassword: "pw"}, "Basic Y2k6cHc="},
+		{"none", Config{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, requests := fetchServer(t)
+			if _, err := NewFetcher(tt.cfg).Read(srv.URL); err != nil {
+				t.Fatal(err)
+			}
+			if got := (*requests)[0].Header.Get("Authorization"); got != tt.want {
+				t.Errorf("Authorization %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderUsesDefaultFetcher(t *testing.T) {
+	srv, requests := fetchServer(t)
+	defer func(f *Fetcher) { DefaultFetcher = f }(DefaultFetcher)
+	DefaultFetcher = NewFetcher(Config{TemplateToken: "t0ken"})
+
+	if _, err := Render(srv.URL+"/service.yaml", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := (*requests)[0].Header.Get("Authorization"); got != "Bearer t0ken" {
+		t.Errorf("Authorization %q", got)
+	}
+}
@@ -0,0 +1,64 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ExpandTemplates turns the template setting, a list of files, directories
+// and globs like k8s/*.yaml, into the list of files to render. Files of a
+// directory or a glob are sorted by name.
+func ExpandTemplates(patterns []string) ([]string, error) {
+	var files []string
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+
+		if IsURL(pattern) {
+			files = append(files, pattern)
+			continue
+		}
+		if strings.ContainsAny(pattern, "*?[") {
+			matches, err := filepath.Glob(pattern)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid template pattern %s", pattern)
+			}
+			if len(matches) == 0 {
+				return nil, errors.Errorf("no template matches %s", pattern)
+			}
+			sort.Strings(matches)
+			files = append(files, matches...)
+			continue
+		}
+
+		info, err := os.Stat(pattern)
+		if err != nil || !info.IsDir() {
+			// plain files are reported missing when they are read
+			files = append(files, pattern)
+			continue
+		}
+		entries, err := ioutil.ReadDir(pattern)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			switch filepath.Ext(entry.Name()) {
+			case ".yaml", ".yml", ".json":
+				if !entry.IsDir() {
+					files = append(files, filepath.Join(pattern, entry.Name()))
+				}
+			}
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,119 @@
+package util
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh/knownhosts"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/client"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/server"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
+)
+
+func init() {
+	// serve local repositories in-process instead of through the git binary,
+	// which the plugin image does not have.
+	client.InstallProtocol("file", server.DefaultServer)
+}
+
+// CloneTemplates clones Config.TemplateRepo into a temporary directory, checks
+// out Config.TemplateRef and returns the location of Config.TemplatePath in
+// it. cleanup removes the clone again.
+func CloneTemplates(cfg Config) (path string, cleanup func(), err error) {
+	dir, err := ioutil.TempDir("", "drone-kube-templates")
+	if err != nil {
+		return "", nil, errors.WithStack(err)
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+
+	auth, err := repoAuth(cfg)
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	repo, err := git.PlainClone(dir, false, &git.CloneOptions{
+		URL:  cfg.TemplateRepo,
+		Auth: auth,
+		Tags: git.AllTags,
+	})
+	if err != nil {
+		cleanup()
+		return "", nil, errors.Wrapf(err, "cannot clone %s", cfg.TemplateRepo)
+	}
+
+	if cfg.TemplateRef != "" {
+		hash, err := repo.ResolveRevision(plumbing.Revision(cfg.TemplateRef))
+		if err != nil {
+			// branches other than the default one only exist on the remote
+			hash, err = repo.ResolveRevision(plumbing.Revision("origin/" + cfg.TemplateRef))
+		}
+		if err != nil {
+			cleanup()
+			return "", nil, errors.Wrapf(err, "cannot resolve %s in %s", cfg.TemplateRef, cfg.TemplateRepo)
+		}
+		wt, err := repo.Worktree()
+		if err != nil {
+			cleanup()
+			return "", nil, errors.WithStack(err)
+		}
+		if err = wt.Checkout(&git.CheckoutOptions{Hash: *hash, Force: true}); err != nil {
+			cleanup()
+			return "", nil, errors.WithStack(err)
+		}
+		log.Println("checkout templates at " + cfg.TemplateRef + " (" + hash.String() + ")")
+	}
+
+	path = filepath.Join(dir, cfg.TemplatePath)
+	if path != dir && !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+		cleanup()
+		return "", nil, errors.Errorf("template path %s is outside of the repository", cfg.TemplatePath)
+	}
+	return path, cleanup, nil
+}
+
+// repoAuth picks ssh key or token authentication for the template repository.
+func repoAuth(cfg Config) (transport.AuthMethod, error) {
+	if cfg.TemplateRepoSSHKey != "" {
+		auth, err := ssh.NewPublicKeys("git", []byte(cfg.TemplateRepoSSHKey), "")
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid template repository ssh key")
+		}
+		if cfg.TemplateRepoKnownHosts == "" {
+			// the known_hosts of the system, as ssh would use
+			if auth.HostKeyCallback, err = ssh.NewKnownHostsCallback(); err != nil {
+				return nil, errors.Wrap(err, "template_repo_known_hosts is needed to verify the template repository server")
+			}
+		} else {
+			f, err := ioutil.TempFile("", "known_hosts")
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			defer os.Remove(f.Name())
+			if _, err = f.WriteString(cfg.TemplateRepoKnownHosts); err != nil {
+				f.Close()
+				return nil, errors.WithStack(err)
+			}
+			f.Close()
+			if auth.HostKeyCallback, err = knownhosts.New(f.Name()); err != nil {
+				return nil, errors.Wrap(err, "invalid template repository known hosts")
+			}
+		}
+		return auth, nil
+	}
+	if cfg.TemplateRepoToken != "" {
+		username := cfg.TemplateRepoUsername
+		if username == "" {
+			username = "git"
+		}
+		return &http.BasicAuth{Username: username, Password: cfg.TemplateRepoToken}, nil
+	}
+	return nil, nil
+}
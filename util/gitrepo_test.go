@@ -0,0 +1,114 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// templateRepo creates a bare repository with k8s/app.yaml at three
+// commits: v1 tagged v1.0.0, v2 on master and v3 on the branch feature.
+// It returns the file:// url and the hash of the v2 commit.
+func templateRepo(t *testing.T) (string, string) {
+	t.Helper()
+	work, bare := filepath.Join(t.TempDir(), "work"), filepath.Join(t.TempDir(), "bare.git")
+	repo, err := git.PlainInit(work, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = git.PlainInit(bare, true); err != nil {
+		t.Fatal(err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := func(content string) plumbing.Hash {
+		if err := os.MkdirAll(filepath.Join(work, "k8s"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(work, "k8s", "app.yaml"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := wt.Add("k8s/app.yaml"); err != nil {
+			t.Fatal(err)
+		}
+		hash, err := wt.Commit(content, &git.CommitOptions{
+			Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+
+	v1 := commit("v1")
+	if _, err = repo.CreateTag("v1.0.0", v1, nil); err != nil {
+		t.Fatal(err)
+	}
+	v2 := commit("v2")
+	if err = wt.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName("feature"), Create: true}); err != nil {
+		t.Fatal(err)
+	}
+	commit("v3")
+
+	remote, err := repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{"file://" + bare}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = remote.Push(&git.PushOptions{RefSpecs: []config.RefSpec{"refs/heads/*:refs/heads/*", "refs/tags/*:refs/tags/*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "file://" + bare, v2.String()
+}
+
+func TestCloneTemplates(t *testing.T) {
+	url, v2 := templateRepo(t)
+
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"", "v2"},
+		{"v1.0.0", "v1"},
+		{"feature", "v3"},
+		{v2, "v2"},
+	}
+	for _, test := range tests {
+		path, cleanup, err := CloneTemplates(Config{TemplateRepo: url, TemplateRef: test.ref, TemplatePath: "k8s/app.yaml"})
+		if err != nil {
+			t.Fatalf("ref %q: %v", test.ref, err)
+		}
+		out, err := ioutil.ReadFile(path)
+		cleanup()
+		if err != nil {
+			t.Fatalf("ref %q: %v", test.ref, err)
+		}
+		if string(out) != test.want {
+			t.Errorf("ref %q: got %q, want %q", test.ref, out, test.want)
+		}
+	}
+}
+
+func TestCloneTemplatesErrors(t *testing.T) {
+	url, _ := templateRepo(t)
+
+	tests := []Config{
+		{TemplateRepo: url, TemplateRef: "missing"},
+		{TemplateRepo: url, TemplatePath: "../outside"},
+		{TemplateRepo: "file://" + filepath.Join(t.TempDir(), "missing.git")},
+	}
+	for _, cfg := range tests {
+		if _, _, err := CloneTemplates(cfg); err == nil {
+			t.Errorf("%+v: expected an error", cfg)
+		}
+	}
+}
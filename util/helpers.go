@@ -0,0 +1,126 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/aymerick/raymond"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// helpers for writing kubernetes manifests. They return safe strings since
+// manifests are not html and must not be escaped. Errors are raised by
+// panicking with an error, which raymond turns into a render error.
+
+func dns1123(s string) raymond.SafeString {
+	return raymond.SafeString(DNS1123(s))
+}
+
+func b64enc(s string) raymond.SafeString {
+	return raymond.SafeString(base64.StdEncoding.EncodeToString([]byte(s)))
+}
+
+func b64dec(s string) raymond.SafeString {
+	out, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		panic(errors.Wrap(err, "b64dec"))
+	}
+	return raymond.SafeString(out)
+}
+
+func sha256sum(s string) raymond.SafeString {
+	sum := sha256.Sum256([]byte(s))
+	return raymond.SafeString(hex.EncodeToString(sum[:]))
+}
+
+func toJSON(v interface{}) raymond.SafeString {
+	out, err := json.Marshal(v)
+	if err != nil {
+		panic(errors.Wrap(err, "toJson"))
+	}
+	return raymond.SafeString(out)
+}
+
+func toYAML(v interface{}) raymond.SafeString {
+	out, err := yaml.Marshal(v)
+	if err != nil {
+		panic(errors.Wrap(err, "toYaml"))
+	}
+	return raymond.SafeString(strings.TrimSuffix(string(out), "\n"))
+}
+
+func indent(spaces int, s string) raymond.SafeString {
+	pad := strings.Repeat(" ", spaces)
+	return raymond.SafeString(pad + strings.Replace(s, "\n", "\n"+pad, -1))
+}
+
+func nindent(spaces int, s string) raymond.SafeString {
+	return "\n" + indent(spaces, s)
+}
+
+// defaultValue returns value, or def when value is empty: {{default "latest" build.tag}}
+func defaultValue(def interface{}, value interface{}) raymond.SafeString {
+	if isEmpty(value) {
+		return raymond.SafeString(raymond.Str(def))
+	}
+	return raymond.SafeString(raymond.Str(value))
+}
+
+// required fails the render with msg when value is empty: {{required "tag needed" build.tag}}
+func required(msg string, value interface{}) raymond.SafeString {
+	if isEmpty(value) {
+		panic(errors.New(msg))
+	}
+	return raymond.SafeString(raymond.Str(value))
+}
+
+// sensitive returns the value unchanged and masks it in the build logs.
+func sensitive(value interface{}) raymond.SafeString {
+	s := raymond.Str(value)
+	Sensitive(s)
+	return raymond.SafeString(s)
+}
+
+func env(name string) raymond.SafeString {
+	return raymond.SafeString(os.Getenv(name))
+}
+
+// readFile returns the content of a file of the workspace. Paths are relative
+// to the workspace and cannot leave it.
+func readFile(name string) raymond.SafeString {
+	root, err := os.Getwd()
+	if err != nil {
+		panic(errors.WithStack(err))
+	}
+	if filepath.IsAbs(name) {
+		panic(errors.Errorf("readFile: %s is not relative to the workspace", name))
+	}
+	path := filepath.Join(root, name)
+	if !strings.HasPrefix(path, root+string(filepath.Separator)) {
+		panic(errors.Errorf("readFile: %s is outside of the workspace", name))
+	}
+	out, err := ioutil.ReadFile(path)
+	if err != nil {
+		panic(errors.Wrap(err, "readFile"))
+	}
+	return raymond.SafeString(out)
+}
+
+func quote(v interface{}) raymond.SafeString {
+	return raymond.SafeString(strconv.Quote(raymond.Str(v)))
+}
+
+func isEmpty(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	return raymond.Str(value) == ""
+}
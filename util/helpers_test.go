@@ -0,0 +1,155 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type helperTest struct {
+	template string
+	payload  interface{}
+	want     string
+	err      bool
+}
+
+func runHelperTests(t *testing.T, tests []helperTest) {
+	t.Helper()
+	for _, test := range tests {
+		out, err := Render(test.template, test.payload)
+		switch {
+		case test.err && err == nil:
+			t.Errorf("%s: expected an error, got %q", test.template, out)
+		case !test.err && err != nil:
+			t.Errorf("%s: %v", test.template, err)
+		case !test.err && out != test.want:
+			t.Errorf("%s: got %q, want %q", test.template, out, test.want)
+		}
+	}
+}
+
+func TestDNS1123Helper(t *testing.T) {
+	runHelperTests(t, []helperTest{
+		{`{{dns1123 "feature/Login_Page"}}`, nil, "feature-login-page", false},
+		{`{{dns1123 "--release--1.2--"}}`, nil, "release-1-2", false},
+		{`{{dns1123 s}}`, map[string]string{"s": strings.Repeat("a", 62) + "-bc"}, strings.Repeat("a", 62), false},
+		{`{{dns1123 "../"}}`, nil, "", false},
+	})
+}
+
+func TestBase64Helpers(t *testing.T) {
+	runHelperTests(t, []helperTest{
+		{`{{b64enc "user:pass"}}`, nil, "dXNlcjpwYXNz", false},
+		{`{{b64enc ""}}`, nil, "", false},
+		{`{{b64dec "dXNlcjpwYXNz"}}`, nil, "user:pass", false},
+		{`{{b64dec (b64enc "<&>")}}`, nil, "<&>", false},
+		{`{{b64dec "not base64!"}}`, nil, "", true},
+	})
+}
+
+func TestSHA256Helper(t *testing.T) {
+	runHelperTests(t, []helperTest{
+		{`{{sha256 ""}}`, nil, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", false},
+		{`{{sha256 "abc"}}`, nil, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", false},
+	})
+}
+
+func TestSerializeHelpers(t *testing.T) {
+	payload := map[string]interface{}{
+		"text":   `say "hi" <now>`,
+		"labels": map[string]interface{}{"app": "web", "tier": "front"},
+		"ports":  []int{80, 443},
+	}
+	runHelperTests(t, []helperTest{
+		{`{{toJson text}}`, payload, `"say \"hi\" \u003cnow\u003e"`, false},
+		{`{{toJson labels}}`, payload, `{"app":"web","tier":"front"}`, false},
+		{`{{toJson ports}}`, payload, `[80,443]`, false},
+		{`{{toYaml labels}}`, payload, "app: web\ntier: front", false},
+		{`{{toYaml ports}}`, payload, "- 80\n- 443", false},
+		{`{{toYaml text}}`, payload, `say "hi" <now>`, false},
+	})
+}
+
+func TestIndentHelpers(t *testing.T) {
+	payload := map[string]interface{}{"block": "a: 1\nb: 2"}
+	runHelperTests(t, []helperTest{
+		{`{{indent 2 block}}`, payload, "  a: 1\n  b: 2", false},
+		{`{{indent 0 block}}`, payload, "a: 1\nb: 2", false},
+		{`x:{{nindent 4 block}}`, payload, "x:\n    a: 1\n    b: 2", false},
+		{`x:{{nindent 2 (toYaml labels)}}`, map[string]interface{}{"labels": map[string]string{"app": "web"}}, "x:\n  app: web", false},
+	})
+}
+
+func TestDefaultHelper(t *testing.T) {
+	runHelperTests(t, []helperTest{
+		{`{{default "latest" tag}}`, map[string]string{"tag": "1.2.3"}, "1.2.3", false},
+		{`{{default "latest" tag}}`, map[string]string{"tag": ""}, "latest", false},
+		{`{{default "latest" tag}}`, map[string]string{}, "latest", false},
+		{`{{default 1 replicas}}`, map[string]int{"replicas": 3}, "3", false},
+	})
+}
+
+func TestRequiredHelper(t *testing.T) {
+	runHelperTests(t, []helperTest{
+		{`{{required "tag needed" tag}}`, map[string]string{"tag": "1.2.3"}, "1.2.3", false},
+		{`{{required "tag needed" tag}}`, map[string]string{"tag": ""}, "", true},
+		{`{{required "tag needed" tag}}`, map[string]string{}, "", true},
+	})
+
+	_, err := Render(`{{required "tag needed" tag}}`, nil)
+	if err == nil || !strings.Contains(err.Error(), "tag needed") {
+		t.Errorf("expected the message in the error, got %v", err)
+	}
+}
+
+func TestEnvHelper(t *testing.T) {
+	os.Setenv("DRONE_KUBE_TEST_ENV", "value")
+	defer os.Unsetenv("DRONE_KUBE_TEST_ENV")
+	runHelperTests(t, []helperTest{
+		{`{{env "DRONE_KUBE_TEST_ENV"}}`, nil, "value", false},
+		{`{{env "DRONE_KUBE_TEST_UNSET"}}`, nil, "", false},
+	})
+}
+
+func TestReadFileHelper(t *testing.T) {
+	root := t.TempDir()
+	workspace := filepath.Join(root, "workspace")
+	if err := os.MkdirAll(filepath.Join(workspace, "config"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(workspace, "config", "app.conf"), []byte("port = 80"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "secret"), []byte("outside"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(workspace); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	runHelperTests(t, []helperTest{
+		{`{{readFile "config/app.conf"}}`, nil, "port = 80", false},
+		{`{{readFile "./config/../config/app.conf"}}`, nil, "port = 80", false},
+		{`{{readFile "../secret"}}`, nil, "", true},
+		{`{{readFile "config/../../secret"}}`, nil, "", true},
+		{`{{readFile path}}`, map[string]string{"path": filepath.Join(root, "secret")}, "", true},
+		{`{{readFile "."}}`, nil, "", true},
+		{`{{readFile "config/missing"}}`, nil, "", true},
+	})
+}
+
+func TestQuoteHelper(t *testing.T) {
+	runHelperTests(t, []helperTest{
+		{`{{quote "1.10"}}`, nil, `"1.10"`, false},
+		{`{{quote s}}`, map[string]string{"s": `say "hi"` + "\n"}, `"say \"hi\"\n"`, false},
+		{`{{quote n}}`, map[string]int{"n": 8080}, `"8080"`, false},
+		{`{{quote b}}`, map[string]bool{"b": true}, `"true"`, false},
+	})
+}
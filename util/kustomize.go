@@ -0,0 +1,104 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/kustomize/k8sdeps"
+	"sigs.k8s.io/kustomize/pkg/fs"
+	"sigs.k8s.io/kustomize/pkg/loader"
+	"sigs.k8s.io/kustomize/pkg/target"
+	"sigs.k8s.io/yaml"
+)
+
+// Kustomize builds the kustomization in dir, like `kustomize build dir`,
+// and returns the resulting documents as yaml.
+func Kustomize(dir string) (string, error) {
+	f := k8sdeps.NewFactory()
+	ldr, err := loader.NewLoader(dir, fs.MakeRealFS())
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer ldr.Cleanup()
+
+	kt, err := target.NewKustTarget(ldr, f.ResmapF, f.TransformerF)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	resources, err := kt.MakeCustomizedResMap()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	out, err := resources.EncodeAsYaml()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return string(out), nil
+}
+
+// the fields of a kustomization that refer to local files or directories
+type kustomization struct {
+	Resources             []string `json:"resources"`
+	Bases                 []string `json:"bases"`
+	PatchesStrategicMerge []string `json:"patchesStrategicMerge"`
+	PatchesJSON6902       []struct {
+		Path string `json:"path"`
+	} `json:"patchesJson6902"`
+}
+
+// KustomizeSources returns the local files the kustomization in dir is built
+// from, following its bases. Remote bases are left out.
+func KustomizeSources(dir string) ([]string, error) {
+	var files []string
+	seen := map[string]bool{}
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		if seen[dir] {
+			return nil
+		}
+		seen[dir] = true
+
+		var raw []byte
+		var err error
+		for _, name := range []string{"kustomization.yaml", "kustomization.yml", "Kustomization"} {
+			if raw, err = ioutil.ReadFile(filepath.Join(dir, name)); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return errors.Wrapf(err, "no kustomization in %s", dir)
+		}
+		k := kustomization{}
+		if err = yaml.Unmarshal(raw, &k); err != nil {
+			return errors.Wrapf(err, "invalid kustomization in %s", dir)
+		}
+
+		paths := append(append(k.Resources, k.Bases...), k.PatchesStrategicMerge...)
+		for _, p := range k.PatchesJSON6902 {
+			paths = append(paths, p.Path)
+		}
+		for _, p := range paths {
+			path := filepath.Join(dir, p)
+			info, err := os.Stat(path)
+			if os.IsNotExist(err) {
+				// a remote base
+				continue
+			}
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			if info.IsDir() {
+				if err = walk(path); err != nil {
+					return err
+				}
+				continue
+			}
+			files = append(files, path)
+		}
+		return nil
+	}
+	err := walk(filepath.Clean(dir))
+	return files, err
+}
@@ -0,0 +1,111 @@
+package util
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Metrics is a set of gauges, written in the prometheus text format.
+type Metrics struct {
+	families []*metricFamily
+}
+
+type metricFamily struct {
+	name    string
+	help    string
+	samples []metricSample
+}
+
+type metricSample struct {
+	labels map[string]string
+	value  float64
+}
+
+// Set sets the gauge of that name for the labels.
+func (m *Metrics) Set(name, help string, labels map[string]string, value float64) {
+	var family *metricFamily
+	for _, f := range m.families {
+		if f.name == name {
+			family = f
+		}
+	}
+	if family == nil {
+		family = &metricFamily{name: name, help: help}
+		m.families = append(m.families, family)
+	}
+	family.samples = append(family.samples, metricSample{labels: labels, value: value})
+}
+
+// WriteTo writes the metrics in the prometheus text format, or as
+// OpenMetrics, which ends with # EOF.
+func (m *Metrics) WriteTo(w io.Writer, openMetrics bool) error {
+	var buf bytes.Buffer
+	for _, f := range m.families {
+		fmt.Fprintf(&buf, "# HELP %s %s\n", f.name, f.help)
+		fmt.Fprintf(&buf, "# TYPE %s gauge\n", f.name)
+		for _, s := range f.samples {
+			buf.WriteString(f.name)
+			if len(s.labels) > 0 {
+				names := make([]string, 0, len(s.labels))
+				for name := range s.labels {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				pairs := make([]string, len(names))
+				for i, name := range names {
+					pairs[i] = name + `="` + escapeLabel(s.labels[name]) + `"`
+				}
+				buf.WriteString("{" + strings.Join(pairs, ",") + "}")
+			}
+			buf.WriteString(" " + strconv.FormatFloat(s.value, 'g', -1, 64) + "\n")
+		}
+	}
+	if openMetrics {
+		buf.WriteString("# EOF\n")
+	}
+	_, err := w.Write(buf.Bytes())
+	return errors.WithStack(err)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// Push replaces the metrics of the job and grouping labels on a prometheus
+// pushgateway.
+func (m *Metrics) Push(hook *Webhook, gateway, job string, grouping map[string]string) error {
+	path := "/metrics/job" + groupingSegment(job)
+	names := make([]string, 0, len(grouping))
+	for name := range grouping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		path += "/" + name + groupingSegment(grouping[name])
+	}
+
+	var buf bytes.Buffer
+	if err := m.WriteTo(&buf, false); err != nil {
+		return err
+	}
+	push := *hook
+	push.Method = http.MethodPut
+	push.Headers = map[string]string{"Content-Type": "text/plain; version=0.0.4"}
+	return push.Post(strings.TrimRight(gateway, "/")+path, buf.Bytes())
+}
+
+// values are base64 encoded, they may contain slashes or be empty
+func groupingSegment(value string) string {
+	if value == "" {
+		return "@base64/="
+	}
+	return "@base64/" + base64.URLEncoding.EncodeToString([]byte(value))
+}
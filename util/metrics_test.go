@@ -0,0 +1,53 @@
+package util
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMetricsPush(t *testing.T) {
+	m := &Metrics{}
+	m.Set("deploy_success", "Whether the deploy succeeded.", map[string]string{"repo": "goerzh/app", "cluster": `eu "1"`}, 1)
+	m.Set("deploy_success", "Whether the deploy succeeded.", map[string]string{"repo": "goerzh/app", "cluster": "us"}, 0)
+	m.Set("deploy_duration_seconds", "Time the deploy took.", nil, 12.5)
+
+	var method, path, contentType, body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path, contentType = r.Method, r.URL.EscapedPath(), r.Header.Get("Content-Type")
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	hook := &Webhook{Client: &http.Client{Timeout: 5 * time.Second}, Headers: map[string]string{"X-Ignored": "1"}}
+	grouping := map[string]string{"repo": "goerzh/app", "environment": ""}
+	if err := m.Push(hook, srv.URL+"/", "drone-kube", grouping); err != nil {
+		t.Fatal(err)
+	}
+
+	if method != http.MethodPut {
+		t.Errorf("method %s, want PUT", method)
+	}
+	// values are base64url, so the slash of the repo does not split the path
+	if want := "/metrics/job@base64/ZHJvbmUta3ViZQ==/environment@base64/=/repo@base64/Z29lcnpoL2FwcA=="; path != want {
+		t.Errorf("path %s, want %s", path, want)
+	}
+	if want := "text/plain; version=0.0.4"; contentType != want {
+		t.Errorf("content type %q, want %q", contentType, want)
+	}
+	want := `# HELP deploy_success Whether the deploy succeeded.
+# TYPE deploy_success gauge
+deploy_success{cluster="eu \"1\"",repo="goerzh/app"} 1
+deploy_success{cluster="us",repo="goerzh/app"} 0
+# HELP deploy_duration_seconds Time the deploy took.
+# TYPE deploy_duration_seconds gauge
+deploy_duration_seconds 12.5
+`
+	if body != want {
+		t.Errorf("body:\n%s\nwant:\n%s", body, want)
+	}
+}
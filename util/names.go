@@ -0,0 +1,28 @@
+package util
+
+import (
+	"strings"
+)
+
+// DNS1123 turns a string like a branch name into a valid DNS-1123 label:
+// lowercase alphanumerics and dashes, starting and ending with an
+// alphanumeric, at most 63 characters.
+func DNS1123(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash {
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+
+	out := strings.Trim(b.String(), "-")
+	if len(out) > 63 {
+		out = strings.TrimRight(out[:63], "-")
+	}
+	return out
+}
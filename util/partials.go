@@ -0,0 +1,43 @@
+package util
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// partials are made available to every template rendered by Render.
+var partials = map[string]string{}
+
+// LoadPartials registers every *.yaml, *.yml and *.hbs file of dir as a
+// partial named after the file without its extension, so deployment.yaml can
+// use {{> sidecar}} for dir/sidecar.yaml.
+func LoadPartials(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		switch ext {
+		case ".yaml", ".yml", ".hbs":
+		default:
+			continue
+		}
+		if entry.IsDir() {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), ext)
+		if _, ok := partials[name]; ok {
+			return errors.Errorf("partial %s is defined twice in %s", name, dir)
+		}
+		out, err := ioutil.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		partials[name] = string(out)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package util
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Mask replaces sensitive values in output.
+const Mask = "*****"
+
+// shorter free-form values are not masked, they would mask common words all
+// over
+const minSensitive = 6
+
+// Redactor masks sensitive values in text meant for build logs.
+type Redactor struct {
+	mu       sync.RWMutex
+	values   map[string]bool
+	replacer *strings.Replacer
+}
+
+// DefaultRedactor masks the values marked with Sensitive. The log output and
+// the output of the render command go through it.
+var DefaultRedactor = NewRedactor()
+
+func NewRedactor() *Redactor {
+	return &Redactor{values: map[string]bool{}, replacer: strings.NewReplacer()}
+}
+
+// Add marks values as sensitive, whatever their length. Every line of a
+// multi-line value, like a private key, is masked on its own as well, if it
+// is long enough not to be a common word.
+func (r *Redactor) Add(values ...string) {
+	r.add(0, values)
+}
+
+// AddText marks free-form values as sensitive, like environment variables
+// that may hold anything. Values shorter than 6 characters are ignored.
+func (r *Redactor) AddText(values ...string) {
+	r.add(minSensitive, values)
+}
+
+func (r *Redactor) add(min int, values []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	added := false
+	mark := func(s string, min int) {
+		s = strings.TrimSpace(s)
+		if s != "" && len(s) >= min && !r.values[s] {
+			r.values[s] = true
+			added = true
+		}
+	}
+	for _, v := range values {
+		mark(v, min)
+		if strings.Contains(v, "\n") {
+			for _, line := range strings.Split(v, "\n") {
+				mark(line, minSensitive)
+			}
+		}
+	}
+	if !added {
+		return
+	}
+
+	// longest first, so a value containing another is masked as a whole
+	all := make([]string, 0, len(r.values))
+	for s := range r.values {
+		all = append(all, s)
+	}
+	sort.Slice(all, func(i, j int) bool { return len(all[i]) > len(all[j]) })
+	pairs := make([]string, 0, len(all)*2)
+	for _, s := range all {
+		pairs = append(pairs, s, Mask)
+	}
+	r.replacer = strings.NewReplacer(pairs...)
+}
+
+// Redact masks the sensitive values in s.
+func (r *Redactor) Redact(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.replacer.Replace(s)
+}
+
+// Writer returns a writer masking the sensitive values of what is written to
+// w. It writes whole lines only, so a value split across writes is masked
+// too; Close writes the last line if it has no newline.
+func (r *Redactor) Writer(w io.Writer) io.WriteCloser {
+	return &redactWriter{w: w, r: r}
+}
+
+type redactWriter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	r   *Redactor
+	buf []byte
+}
+
+func (w *redactWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	i := bytes.LastIndexByte(w.buf, '\n')
+	if i < 0 {
+		return len(p), nil
+	}
+	if _, err := io.WriteString(w.w, w.r.Redact(string(w.buf[:i+1]))); err != nil {
+		return 0, err
+	}
+	w.buf = append(w.buf[:0], w.buf[i+1:]...)
+	return len(p), nil
+}
+
+func (w *redactWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(w.w, w.r.Redact(string(w.buf)))
+	w.buf = nil
+	return err
+}
+
+// Sensitive marks values as sensitive for the DefaultRedactor.
+func Sensitive(values ...string) {
+	DefaultRedactor.Add(values...)
+}
+
+// SensitiveText marks free-form values as sensitive for the DefaultRedactor.
+func SensitiveText(values ...string) {
+	DefaultRedactor.AddText(values...)
+}
+
+// Redact masks the values marked as sensitive in s.
+func Redact(s string) string {
+	return DefaultRedactor.Redact(s)
+}
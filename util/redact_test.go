@@ -0,0 +1,87 @@
+package util
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestRedactorShortValues(t *testing.T) {
+	r := NewRedactor()
+	r.Add("abc") // a short token or secret value is masked all the same
+	r.AddText("dev", "hunter2")
+
+	got := r.Redact("token abc, env dev, password hunter2")
+	want := "token *****, env dev, password *****"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRedactorEmptyValue(t *testing.T) {
+	r := NewRedactor()
+	r.Add("", "  ")
+	if got := r.Redact("nothing to mask"); got != "nothing to mask" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestRedactorOverlappingValues(t *testing.T) {
+	r := NewRedactor()
+	r.Add("secret", "secret-password", "password-reset")
+
+	got := r.Redact("a secret-password and a password-reset")
+	want := "a ***** and a *****"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRedactorMultiLine(t *testing.T) {
+	r := NewRedactor()
+	r.Add("-----BEGIN KEY-----\nMIIEpAIBAAKCAQEA\nab\n-----END KEY-----")
+
+	got := r.Redact("line MIIEpAIBAAKCAQEA, short ab")
+	want := "line *****, short ab"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRedactorBase64(t *testing.T) {
+	plain := "s3cr"
+	encoded := base64.StdEncoding.EncodeToString([]byte(plain))
+	r := NewRedactor()
+	r.Add(plain, encoded)
+
+	got := r.Redact("data: " + encoded + ", stringData: " + plain)
+	want := "data: *****, stringData: *****"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRedactWriterSplitValue(t *testing.T) {
+	r := NewRedactor()
+	r.Add("hunter2")
+	var buf bytes.Buffer
+	w := r.Writer(&buf)
+
+	for _, chunk := range []string{"password: hun", "ter2\nuser: ", "admin", "\nkey: hunt", "er2"} {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if strings.Contains(buf.String(), "key") {
+		t.Errorf("the last line was written before Close: %q", buf.String())
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "password: *****\nuser: admin\nkey: *****"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,40 @@
+package util
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var semverPattern = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(?:-([0-9A-Za-z.-]+))?(?:\+([0-9A-Za-z.-]+))?$`)
+
+// Semver is a semantic version, as parsed from a git tag like v1.2.3-rc.1.
+// Version is the tag without its v prefix.
+type Semver struct {
+	Version    string
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string
+	Build      string
+}
+
+// ParseSemver parses a tag with an optional v prefix. It returns nil when
+// the tag is not a semantic version.
+func ParseSemver(tag string) *Semver {
+	m := semverPattern.FindStringSubmatch(tag)
+	if m == nil {
+		return nil
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	patch, _ := strconv.Atoi(m[3])
+	return &Semver{
+		Version:    strings.TrimPrefix(tag, "v"),
+		Major:      major,
+		Minor:      minor,
+		Patch:      patch,
+		Prerelease: m[4],
+		Build:      m[5],
+	}
+}
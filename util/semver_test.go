@@ -0,0 +1,26 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSemver(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want *Semver
+	}{
+		{"v1.2.3", &Semver{Version: "1.2.3", Major: 1, Minor: 2, Patch: 3}},
+		{"1.2.3-rc.1+build.5", &Semver{Version: "1.2.3-rc.1+build.5", Major: 1, Minor: 2, Patch: 3, Prerelease: "rc.1", Build: "build.5"}},
+		{"v10.0.12-beta", &Semver{Version: "10.0.12-beta", Major: 10, Minor: 0, Patch: 12, Prerelease: "beta"}},
+		{"release-1", nil},
+		{"v1.2", nil},
+		{"v01.2.3", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := ParseSemver(tt.tag); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseSemver(%q) = %+v, want %+v", tt.tag, got, tt.want)
+		}
+	}
+}
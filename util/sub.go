@@ -4,8 +4,6 @@ package util
 // https://raw.githubusercontent.com/drone-plugins/drone-slack/master/template.go
 import (
 	"fmt"
-	"io/ioutil"
-	"net/http"
 	"net/url"
 	"strings"
 	"time"
@@ -21,7 +19,7 @@ func init() {
 
 // open up the template and then sub variables in. Handlebar stuff.
 func OpenAndSub(templateFile string, p interface{}) (string, error) {
-	t, err := ioutil.ReadFile(templateFile)
+	t, err := DefaultFetcher.Read(templateFile)
 	if err != nil {
 		return "", err
 	}
@@ -31,31 +29,27 @@ func OpenAndSub(templateFile string, p interface{}) (string, error) {
 
 // Render parses and executes a template, returning the results in string format.
 func Render(template string, payload interface{}) (s string, err error) {
-	u, err := url.Parse(template)
-	if err == nil {
-		switch u.Scheme {
-		case "http", "https":
-			res, err := http.Get(template)
-			if err != nil {
-				return s, err
-			}
-			defer res.Body.Close()
-			out, err := ioutil.ReadAll(res.Body)
-			if err != nil {
-				return s, err
-			}
-			template = string(out)
-
-		case "file":
-			out, err := ioutil.ReadFile(u.Path)
-			if err != nil {
-				return s, err
-			}
-			template = string(out)
+	if IsURL(template) {
+		out, err := DefaultFetcher.Read(template)
+		if err != nil {
+			return s, err
 		}
+		template = string(out)
 	}
+	return RenderText(template, payload)
+}
 
-	return raymond.Render(template, payload)
+// RenderText executes a template given as text, even one that looks like a
+// url, e.g. the url of a smoke test.
+func RenderText(template string, payload interface{}) (s string, err error) {
+	tpl, err := raymond.Parse(template)
+	if err != nil {
+		return s, err
+	}
+	if len(partials) > 0 {
+		tpl.RegisterPartials(partials)
+	}
+	return tpl.Exec(payload)
 }
 
 // RenderTrim parses and executes a template, returning the results in string
@@ -77,6 +71,20 @@ var funcs = map[string]interface{}{
 	"truncate":       truncate,
 	"urlencode":      urlencode,
 	"since":          since,
+	"dns1123":        dns1123,
+	"b64enc":         b64enc,
+	"b64dec":         b64dec,
+	"sha256":         sha256sum,
+	"toJson":         toJSON,
+	"toYaml":         toYAML,
+	"indent":         indent,
+	"nindent":        nindent,
+	"default":        defaultValue,
+	"required":       required,
+	"env":            env,
+	"readFile":       readFile,
+	"quote":          quote,
+	"sensitive":      sensitive,
 }
 
 func truncate(s string, len int) string {
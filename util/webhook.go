@@ -0,0 +1,63 @@
+package util
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Webhook posts payloads to urls, retrying like the Fetcher does.
+type Webhook struct {
+	Client  *http.Client
+	Headers map[string]string
+	Retries int
+
+	// POST unless set
+	Method string
+}
+
+// Post sends the payload, as json unless the headers say otherwise, and
+// succeeds on any 2xx response.
+func (w *Webhook) Post(endpoint string, payload []byte) error {
+	method := w.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	var lastErr error
+	for attempt := 0; attempt <= w.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(1<<uint(attempt-1)) * time.Second)
+		}
+
+		req, err := http.NewRequest(method, endpoint, bytes.NewReader(payload))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range w.Headers {
+			req.Header.Set(k, v)
+		}
+
+		res, err := w.Client.Do(req)
+		if err != nil {
+			lastErr = errors.WithStack(err)
+			continue
+		}
+		io.Copy(ioutil.Discard, res.Body)
+		res.Body.Close()
+
+		switch {
+		case res.StatusCode >= 200 && res.StatusCode < 300:
+			return nil
+		case retryable(res.StatusCode):
+			lastErr = errors.Errorf("%s %s: %s", method, endpoint, res.Status)
+		default:
+			return errors.Errorf("%s %s: %s", method, endpoint, res.Status)
+		}
+	}
+	return lastErr
+}
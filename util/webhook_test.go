@@ -0,0 +1,65 @@
+package util
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// webhookServer answers with the statuses in turn, repeating the last one,
+// and counts the requests.
+func webhookServer(t *testing.T, statuses ...int) (*httptest.Server, *int) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := statuses[len(statuses)-1]
+		if requests < len(statuses) {
+			status = statuses[requests]
+		}
+		requests++
+		if got := r.Header.Get("Content-Type"); got != "application/json" {
+			t.Errorf("content type %q", got)
+		}
+		if got := r.Header.Get("X-Token"); got != "secret" {
+			t.Errorf("header X-Token %q", got)
+		}
+		if body, _ := ioutil.ReadAll(r.Body); string(body) != `{"text":"hi"}` {
+			t.Errorf("body %q", body)
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestWebhookPost(t *testing.T) {
+	tests := []struct {
+		statuses []int
+		retries  int
+		requests int
+		err      bool
+	}{
+		{[]int{http.StatusOK}, 2, 1, false},
+		{[]int{http.StatusServiceUnavailable, http.StatusNoContent}, 2, 2, false},
+		{[]int{http.StatusTooManyRequests, http.StatusOK}, 1, 2, false},
+		{[]int{http.StatusInternalServerError}, 1, 2, true},
+		{[]int{http.StatusBadRequest}, 2, 1, true},
+		{[]int{http.StatusNotFound, http.StatusOK}, 2, 1, true},
+	}
+	for _, test := range tests {
+		srv, requests := webhookServer(t, test.statuses...)
+		hook := &Webhook{
+			Client:  &http.Client{Timeout: 5 * time.Second},
+			Headers: map[string]string{"X-Token": "secret"},
+			Retries: test.retries,
+		}
+		err := hook.Post(srv.URL, []byte(`{"text":"hi"}`))
+		if test.err != (err != nil) {
+			t.Errorf("%v: got error %v", test.statuses, err)
+		}
+		if *requests != test.requests {
+			t.Errorf("%v: got %d requests, want %d", test.statuses, *requests, test.requests)
+		}
+	}
+}